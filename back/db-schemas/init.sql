@@ -7,9 +7,13 @@ CREATE TABLE IF NOT EXISTS chess.user(
     username citext UNIQUE NOT NULL,
     email TEXT UNIQUE NOT NULL,
     created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    password_hash TEXT NOT NULL
+    password_hash TEXT NOT NULL,
+    -- Moderators can read every chat of a game, roles are given by hand in the database
+    role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator'))
 );
 
+ALTER TABLE chess.user ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator'));
+
 CREATE TABLE IF NOT EXISTS chess.game(
     game_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     white_id UUID NOT NULL REFERENCES chess.user(user_id),
@@ -20,10 +24,76 @@ CREATE TABLE IF NOT EXISTS chess.game(
     result_reason TEXT DEFAULT '',
     last_fen TEXT DEFAULT '',
     started_at TIMESTAMPTZ NOT NULL,
-    ended_at TIMESTAMPTZ NOT NULL
+    ended_at TIMESTAMPTZ NOT NULL,
+    rated BOOLEAN NOT NULL DEFAULT FALSE,
+    clock_base_ms BIGINT NOT NULL DEFAULT 0,
+    clock_increment_ms BIGINT NOT NULL DEFAULT 0,
+    clock_delay_ms BIGINT NOT NULL DEFAULT 0,
+    white_time_ms BIGINT NOT NULL DEFAULT 0,
+    black_time_ms BIGINT NOT NULL DEFAULT 0,
+    time_category TEXT NOT NULL DEFAULT '',
+    white_rating_before DOUBLE PRECISION,
+    white_rating_after DOUBLE PRECISION,
+    black_rating_before DOUBLE PRECISION,
+    black_rating_after DOUBLE PRECISION,
+    variant TEXT NOT NULL DEFAULT 'standard',
+    initial_fen TEXT NOT NULL DEFAULT '',
+    -- Level of the built-in engine for games against the computer, 0 otherwise
+    bot_level SMALLINT NOT NULL DEFAULT 0,
+    -- Opening of standard games (ECO code and name), set when the game ends
+    eco TEXT NOT NULL DEFAULT '',
+    opening TEXT NOT NULL DEFAULT ''
+);
+
+-- Databases created before these columns existed only get them here, CREATE TABLE IF NOT EXISTS skips existing tables
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS rated BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS clock_base_ms BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS clock_increment_ms BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS clock_delay_ms BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS white_time_ms BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS black_time_ms BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS time_category TEXT NOT NULL DEFAULT '';
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS white_rating_before DOUBLE PRECISION;
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS white_rating_after DOUBLE PRECISION;
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS black_rating_before DOUBLE PRECISION;
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS black_rating_after DOUBLE PRECISION;
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS variant TEXT NOT NULL DEFAULT 'standard';
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS initial_fen TEXT NOT NULL DEFAULT '';
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS bot_level SMALLINT NOT NULL DEFAULT 0;
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS eco TEXT NOT NULL DEFAULT '';
+ALTER TABLE chess.game ADD COLUMN IF NOT EXISTS opening TEXT NOT NULL DEFAULT '';
+
+-- Game history of a user, paged by (started_at, game_id)
+CREATE INDEX IF NOT EXISTS game_white_history_idx ON chess.game(white_id, started_at DESC, game_id DESC);
+CREATE INDEX IF NOT EXISTS game_black_history_idx ON chess.game(black_id, started_at DESC, game_id DESC);
+
+
+CREATE TABLE IF NOT EXISTS chess.game_move(
+    game_id UUID NOT NULL REFERENCES chess.game(game_id) ON DELETE CASCADE,
+    ply INT NOT NULL,
+    san TEXT NOT NULL,
+    uci TEXT NOT NULL,
+    fen TEXT NOT NULL,
+    played_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    white_time_ms BIGINT NOT NULL,
+    black_time_ms BIGINT NOT NULL,
+    PRIMARY KEY (game_id, ply)
 );
 
 
+-- Chat of each game, kept for moderators to review. Spectators chat in their own channel, players don't see it
+CREATE TABLE IF NOT EXISTS chess.game_chat(
+    message_id BIGSERIAL PRIMARY KEY,
+    game_id UUID NOT NULL REFERENCES chess.game(game_id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES chess.user(user_id),
+    channel TEXT NOT NULL CHECK (channel IN ('player', 'spectator')),
+    text TEXT NOT NULL,
+    sent_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS game_chat_game_idx ON chess.game_chat(game_id, message_id);
+
+
 CREATE TABLE IF NOT EXISTS chess.user_stats(
     user_id UUID PRIMARY KEY REFERENCES chess.user(user_id),
     wins INT DEFAULT 0,
@@ -33,6 +103,18 @@ CREATE TABLE IF NOT EXISTS chess.user_stats(
     last_updated TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Glicko-2 rating of each user in each time control category (bullet, blitz, rapid, classical)
+CREATE TABLE IF NOT EXISTS chess.user_rating(
+    user_id UUID NOT NULL REFERENCES chess.user(user_id),
+    category TEXT NOT NULL,
+    rating DOUBLE PRECISION NOT NULL DEFAULT 1500,
+    deviation DOUBLE PRECISION NOT NULL DEFAULT 350,
+    volatility DOUBLE PRECISION NOT NULL DEFAULT 0.06,
+    games_played INT NOT NULL DEFAULT 0,
+    last_updated TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, category)
+);
+
 CREATE OR REPLACE FUNCTION init_user_stats()
 RETURNS TRIGGER AS $$
 BEGIN
@@ -46,10 +128,16 @@ AFTER INSERT ON chess.user
 FOR EACH ROW
 EXECUTE FUNCTION init_user_stats();
 
+-- Reserved user for the built-in engine, nobody can log in with it
+INSERT INTO chess.user(user_id, username, email, password_hash)
+VALUES ('00000000-0000-0000-0000-000000000001', 'computer', 'computer@localhost', '!')
+ON CONFLICT DO NOTHING;
+
 CREATE OR REPLACE FUNCTION update_user_stats()
 RETURNS TRIGGER AS $$
 BEGIN
-    IF NEW.result != 'in_progress' AND OLD.result = 'in_progress' THEN
+    -- Aborted games and games against the computer never count towards the stats
+    IF NEW.result != 'in_progress' AND NEW.result != 'aborted' AND OLD.result = 'in_progress' AND NEW.bot_level = 0 THEN
         UPDATE chess.user_stats us
         SET
             games_played = games_played + 1,
@@ -78,6 +166,23 @@ AFTER UPDATE ON chess.game
 FOR EACH ROW
 EXECUTE FUNCTION update_user_stats();
 
+-- Direct challenges (target_id set) and open challenge links (target_id NULL)
+CREATE TABLE IF NOT EXISTS chess.challenge(
+    challenge_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    challenger_id UUID NOT NULL REFERENCES chess.user(user_id),
+    target_id UUID REFERENCES chess.user(user_id),
+    color TEXT NOT NULL DEFAULT 'random' CHECK (color IN ('white', 'black', 'random')),
+    pool TEXT NOT NULL,
+    initial_fen TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled')),
+    game_id UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS challenge_challenger_idx ON chess.challenge(challenger_id, status);
+CREATE INDEX IF NOT EXISTS challenge_target_idx ON chess.challenge(target_id, status);
+
 CREATE TABLE IF NOT EXISTS chess.saved_game(
     game_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     user_id UUID NOT NULL,
@@ -85,5 +190,67 @@ CREATE TABLE IF NOT EXISTS chess.saved_game(
     pgn TEXT NOT NULL,
     last_fen TEXT NOT NULL,
     created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- SHA-256 of the PGN of games imported from a file, so importing the same game twice keeps one copy
+    content_hash TEXT,
     FOREIGN KEY (user_id) REFERENCES chess.user(user_id)
-);
\ No newline at end of file
+);
+
+ALTER TABLE chess.saved_game ADD COLUMN IF NOT EXISTS content_hash TEXT;
+
+-- Saved games of a user, paged by (created_at, game_id)
+CREATE INDEX IF NOT EXISTS saved_game_history_idx ON chess.saved_game(user_id, created_at DESC, game_id DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS saved_game_content_hash_idx ON chess.saved_game(user_id, content_hash) WHERE content_hash IS NOT NULL;
+
+-- Engine analysis of finished games, filled in by the analysis workers of the API
+CREATE TABLE IF NOT EXISTS chess.game_analysis(
+    game_id UUID PRIMARY KEY REFERENCES chess.game(game_id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'done', 'failed')),
+    depth INT NOT NULL DEFAULT 0,
+    nodes BIGINT NOT NULL DEFAULT 0,
+    positions_total INT NOT NULL DEFAULT 0,
+    positions_done INT NOT NULL DEFAULT 0,
+    white_accuracy DOUBLE PRECISION,
+    black_accuracy DOUBLE PRECISION,
+    error TEXT NOT NULL DEFAULT '',
+    requested_by UUID NOT NULL REFERENCES chess.user(user_id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per position of an analysed game, ply 0 is the initial position
+CREATE TABLE IF NOT EXISTS chess.game_analysis_move(
+    game_id UUID NOT NULL REFERENCES chess.game_analysis(game_id) ON DELETE CASCADE,
+    ply INT NOT NULL,
+    san TEXT NOT NULL DEFAULT '',
+    uci TEXT NOT NULL DEFAULT '',
+    eval_cp INT,
+    eval_mate INT,
+    best_move TEXT NOT NULL DEFAULT '',
+    classification TEXT NOT NULL DEFAULT '',
+    accuracy DOUBLE PRECISION,
+    PRIMARY KEY (game_id, ply)
+);
+
+-- Engine analysis of saved games, covering the variations of the PGN as well as its mainline
+CREATE TABLE IF NOT EXISTS chess.saved_game_analysis(
+    saved_game_id UUID PRIMARY KEY REFERENCES chess.saved_game(game_id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'done', 'failed')),
+    depth INT NOT NULL DEFAULT 0,
+    nodes BIGINT NOT NULL DEFAULT 0,
+    positions_total INT NOT NULL DEFAULT 0,
+    positions_done INT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per distinct position of a saved game, keyed by its FEN without the move counters.
+-- Positions that are still in the PGN after an edit keep their evaluation
+CREATE TABLE IF NOT EXISTS chess.saved_game_position(
+    saved_game_id UUID NOT NULL REFERENCES chess.saved_game_analysis(saved_game_id) ON DELETE CASCADE,
+    fen TEXT NOT NULL,
+    eval_cp INT,
+    eval_mate INT,
+    best_move TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (saved_game_id, fen)
+);
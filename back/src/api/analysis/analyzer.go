@@ -0,0 +1,126 @@
+// Package analysis evaluates finished games with a UCI engine, on a bounded pool of workers
+package analysis
+
+import (
+	"context"
+	"database/models"
+	"database/repositories"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"utils/uci"
+
+	"github.com/google/uuid"
+)
+
+var ErrQueueFull = errors.New("analysis queue is full")
+
+type Config struct {
+	Workers   int   // Analyses running at the same time
+	QueueSize int   // Analyses waiting for a worker, more requests are refused
+	Depth     int   // Depth each position is searched to
+	Nodes     int64 // Node budget of each position, used instead of Depth if set
+
+	PositionTimeout  time.Duration // Longest the engine may take on a single position
+	MaxTreePositions int           // Most distinct positions a saved game may have to be analysed
+}
+
+// Analyzer runs the analysis jobs. Their progress and results are kept in the database,
+// so they can be read while running and resumed after a restart
+type Analyzer struct {
+	engine        uci.Engine
+	gameRepo      *repositories.GameRepo
+	savedGameRepo *repositories.SavedGameRepo
+	analysisRepo  *repositories.AnalysisRepo
+	config        Config
+	jobs          chan func()
+
+	mutex sync.Mutex
+	// Saved games with a job queued or running, true if their PGN changed since the job started
+	savedGames map[uuid.UUID]bool
+}
+
+func NewAnalyzer(engine uci.Engine, gameRepo *repositories.GameRepo, savedGameRepo *repositories.SavedGameRepo, analysisRepo *repositories.AnalysisRepo, config Config) *Analyzer {
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+
+	a := &Analyzer{
+		engine:        engine,
+		gameRepo:      gameRepo,
+		savedGameRepo: savedGameRepo,
+		analysisRepo:  analysisRepo,
+		config:        config,
+		jobs:          make(chan func(), config.QueueSize),
+		savedGames:    make(map[uuid.UUID]bool),
+	}
+	for i := 0; i < config.Workers; i++ {
+		go a.worker()
+	}
+	return a
+}
+
+func (a *Analyzer) worker() {
+	for job := range a.jobs {
+		job()
+	}
+}
+
+func (a *Analyzer) submit(job func()) error {
+	select {
+	case a.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// RequestGameAnalysis queues the analysis of a finished game, with one position more than it has moves.
+// If the game already has an analysis that didn't fail, that one is returned instead
+func (a *Analyzer) RequestGameAnalysis(ctx context.Context, gameID uuid.UUID, moves int, requestedBy uuid.UUID) (*models.GameAnalysis, error) {
+	analysis, created, err := a.analysisRepo.CreateGameAnalysis(ctx, gameID, requestedBy, a.config.Depth, a.config.Nodes, moves+1)
+	if err != nil || !created {
+		return analysis, err
+	}
+
+	if err := a.submit(func() { a.analyseGame(gameID) }); err != nil {
+		a.analysisRepo.FailGameAnalysis(ctx, gameID, err.Error())
+		return nil, err
+	}
+	return analysis, nil
+}
+
+// ResumeUnfinished queues again the analyses that were waiting or running when the server stopped
+func (a *Analyzer) ResumeUnfinished(ctx context.Context) error {
+	gameIDs, err := a.analysisRepo.GetUnfinishedGameAnalyses(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, gameID := range gameIDs {
+		if err := a.submit(func() { a.analyseGame(gameID) }); err != nil {
+			a.analysisRepo.FailGameAnalysis(ctx, gameID, err.Error())
+		}
+	}
+
+	savedGameIDs, err := a.analysisRepo.GetUnfinishedSavedGameAnalyses(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, savedGameID := range savedGameIDs {
+		if err := a.queueSavedGame(savedGameID); err != nil {
+			a.analysisRepo.FailSavedGameAnalysis(ctx, savedGameID, err.Error())
+		}
+	}
+	return nil
+}
+
+func (a *Analyzer) analyseGame(gameID uuid.UUID) {
+	ctx := context.Background()
+	if err := a.runGameAnalysis(ctx, gameID); err != nil {
+		fmt.Printf("Analysis of game %s failed: %v\n", gameID, err)
+		a.analysisRepo.FailGameAnalysis(ctx, gameID, err.Error())
+	}
+}
@@ -0,0 +1,69 @@
+package analysis
+
+import "math"
+
+// A mate is scored like a huge advantage, so it maps to a sure win
+const mateCentipawns = 10000
+
+// Drop in winning chances (in percentage points) from which a move is an inaccuracy, a mistake or a blunder
+const (
+	inaccuracyDrop = 5.0
+	mistakeDrop    = 10.0
+	blunderDrop    = 15.0
+)
+
+// evaluation is an engine score from white's point of view
+type evaluation struct {
+	centipawns int
+	// Moves to mate, positive if white mates. On the board the game ended by mate it's zero,
+	// and centipawns is mateCentipawns for the winner
+	mate *int
+}
+
+// centipawnsFor returns the evaluation of the position for the given side, mates count as mateCentipawns
+func (e evaluation) centipawnsFor(white bool) int {
+	cp := e.centipawns
+	if e.mate != nil && *e.mate > 0 {
+		cp = mateCentipawns
+	} else if e.mate != nil && *e.mate < 0 {
+		cp = -mateCentipawns
+	}
+	if !white {
+		return -cp
+	}
+	return cp
+}
+
+// winChance turns an evaluation into the percentage of games a side would win from there, as fitted on real games
+func winChance(centipawns int) float64 {
+	return 50 + 50*(2/(1+math.Exp(-0.00368208*float64(centipawns)))-1)
+}
+
+// moveAccuracy scores a move from 0 to 100 by how much it lowered the winning chances of the player
+func moveAccuracy(drop float64) float64 {
+	accuracy := 103.1668*math.Exp(-0.04354*drop) - 3.1669
+	return math.Min(100, math.Max(0, accuracy))
+}
+
+// classify names a move by how much it lowered the winning chances of the player,
+// unless it's the move the engine would have played
+func classify(drop float64, isBest bool) string {
+	switch {
+	case isBest:
+		return "best"
+	case drop >= blunderDrop:
+		return "blunder"
+	case drop >= mistakeDrop:
+		return "mistake"
+	case drop >= inaccuracyDrop:
+		return "inaccuracy"
+	}
+	return "good"
+}
+
+// rateMove compares the evaluations before and after a move of the given side
+func rateMove(before evaluation, after evaluation, white bool, isBest bool) (string, float64) {
+	drop := winChance(before.centipawnsFor(white)) - winChance(after.centipawnsFor(white))
+	drop = math.Max(0, drop)
+	return classify(drop, isBest), moveAccuracy(drop)
+}
@@ -0,0 +1,189 @@
+package analysis
+
+import (
+	"context"
+	"database/models"
+	"errors"
+	"strings"
+	"utils/uci"
+
+	"github.com/corentings/chess/v2"
+	"github.com/google/uuid"
+)
+
+const standardFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// runGameAnalysis evaluates every position of the game, from the initial one to the last, and rates each move
+// by comparing the evaluations before and after it
+func (a *Analyzer) runGameAnalysis(ctx context.Context, gameID uuid.UUID) error {
+	game, err := a.gameRepo.GetGame(ctx, gameID)
+	if err != nil {
+		return err
+	}
+	if game == nil {
+		return errors.New("game not found")
+	}
+
+	moves, err := a.gameRepo.GetGameMoves(ctx, gameID)
+	if err != nil {
+		return err
+	}
+
+	if err := a.analysisRepo.StartGameAnalysis(ctx, gameID); err != nil {
+		return err
+	}
+
+	fens := make([]string, 0, len(moves)+1)
+	fens = append(fens, initialEngineFEN(game))
+	for _, move := range moves {
+		fens = append(fens, engineFEN(game, move.FEN))
+	}
+
+	var previous evaluation
+	previousBest := ""
+	accuracies := map[bool][]float64{}
+
+	for ply, fen := range fens {
+		eval, best, err := a.evaluate(ctx, fen)
+		if err != nil {
+			return err
+		}
+
+		row := &models.MoveAnalysis{
+			GameID:   gameID,
+			Ply:      ply,
+			BestMove: best,
+		}
+		row.EvalCp, row.EvalMate = eval.columns()
+
+		if ply > 0 {
+			move := moves[ply-1]
+			white := sideToMove(fens[ply-1]) == chess.White
+			classification, accuracy := rateMove(previous, eval, white, move.UCI == previousBest)
+
+			row.SAN = move.SAN
+			row.UCI = move.UCI
+			row.Classification = classification
+			row.Accuracy = &accuracy
+			accuracies[white] = append(accuracies[white], accuracy)
+		}
+
+		if err := a.analysisRepo.AddMoveAnalysis(ctx, row); err != nil {
+			return err
+		}
+		previous = eval
+		previousBest = best
+	}
+
+	return a.analysisRepo.FinishGameAnalysis(ctx, gameID, average(accuracies[true]), average(accuracies[false]))
+}
+
+// evaluate returns the evaluation of a position, from white's point of view, and the move the engine would play.
+// Positions where the game is over are scored without asking the engine
+func (a *Analyzer) evaluate(ctx context.Context, fen string) (evaluation, string, error) {
+	fenOption, err := chess.FEN(fen)
+	if err != nil {
+		return evaluation{}, "", err
+	}
+	pos := chess.NewGame(fenOption).Position()
+	sign := 1
+	if pos.Turn() == chess.Black {
+		sign = -1
+	}
+
+	switch pos.Status() {
+	case chess.Checkmate:
+		mate := 0
+		return evaluation{centipawns: -sign * mateCentipawns, mate: &mate}, "", nil
+	case chess.Stalemate:
+		return evaluation{}, "", nil
+	}
+
+	if a.config.PositionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.config.PositionTimeout)
+		defer cancel()
+	}
+
+	req := uci.Request{FEN: fen, Depth: a.config.Depth}
+	if a.config.Nodes > 0 {
+		req = uci.Request{FEN: fen, Nodes: a.config.Nodes}
+	}
+	result, err := a.engine.Analyse(ctx, req)
+	// A search cut short by the timeout still has an evaluation
+	if result == nil {
+		return evaluation{}, "", err
+	}
+	if len(result.Lines) == 0 {
+		return evaluation{}, "", errors.New("the engine sent no evaluation")
+	}
+
+	score := result.Lines[0].Score
+	eval := evaluation{centipawns: sign * score.Centipawns}
+	if score.IsMate {
+		mate := sign * score.Mate
+		eval.mate = &mate
+	}
+	return eval, result.BestMove, nil
+}
+
+// columns returns the evaluation as it's stored: the mate distance if there's a forced mate,
+// the centipawns otherwise. Mated positions keep both
+func (eval evaluation) columns() (*int, *int) {
+	if eval.mate != nil && *eval.mate != 0 {
+		return nil, eval.mate
+	}
+	cp := eval.centipawns
+	return &cp, eval.mate
+}
+
+// toEvaluation reads back an evaluation stored by columns
+func toEvaluation(position *models.SavedGamePosition) evaluation {
+	eval := evaluation{mate: position.EvalMate}
+	if position.EvalCp != nil {
+		eval.centipawns = *position.EvalCp
+	}
+	return eval
+}
+
+// initialEngineFEN returns the position the game started from, as the engine gets it
+func initialEngineFEN(game *models.Game) string {
+	if game.InitialFEN == "" {
+		return standardFEN
+	}
+	return engineFEN(game, game.InitialFEN)
+}
+
+// engineFEN returns a position of the game as the engine gets it. Chess960 castling rights (Shredder-FEN)
+// are left out, engines only read them in their Chess960 mode and the chess library doesn't read them at all
+func engineFEN(game *models.Game, fen string) string {
+	if game.Variant != "chess960" {
+		return fen
+	}
+
+	fields := strings.Fields(fen)
+	if len(fields) == 6 {
+		fields[2] = "-"
+	}
+	return strings.Join(fields, " ")
+}
+
+func sideToMove(fen string) chess.Color {
+	fields := strings.Fields(fen)
+	if len(fields) > 1 && fields[1] == "b" {
+		return chess.Black
+	}
+	return chess.White
+}
+
+func average(values []float64) *float64 {
+	if len(values) == 0 {
+		return nil
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	avg := sum / float64(len(values))
+	return &avg
+}
@@ -0,0 +1,242 @@
+package analysis
+
+import (
+	"context"
+	"database/models"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+	"github.com/google/uuid"
+)
+
+var ErrTooManyPositions = errors.New("saved game has too many positions to analyse")
+
+// Node is a position of a saved game's PGN tree with its evaluation, reached by the move of the node.
+// The root node is the initial position and has no move
+type Node struct {
+	SAN            string   `json:"san,omitempty"`
+	UCI            string   `json:"uci,omitempty"`
+	FEN            string   `json:"fen"`
+	EvalCp         *int     `json:"eval_cp,omitempty"`
+	EvalMate       *int     `json:"eval_mate,omitempty"`
+	BestMove       string   `json:"best_move,omitempty"`
+	Classification string   `json:"classification,omitempty"`
+	Accuracy       *float64 `json:"accuracy,omitempty"`
+	Children       []*Node  `json:"children,omitempty"` // Mainline first, then the variations
+}
+
+// SavedGameAnalysis is an analysis with its evaluations laid over the PGN tree they belong to
+type SavedGameAnalysis struct {
+	*models.SavedGameAnalysis
+	Tree *Node `json:"tree"`
+}
+
+// RequestSavedGameAnalysis queues the analysis of every position of a saved game that wasn't analysed yet
+func (a *Analyzer) RequestSavedGameAnalysis(ctx context.Context, savedGame *models.SavedGame) (*models.SavedGameAnalysis, error) {
+	root, err := parseTree(savedGame.PGN)
+	if err != nil {
+		return nil, err
+	}
+	if len(treePositions(root)) > a.config.MaxTreePositions {
+		return nil, ErrTooManyPositions
+	}
+
+	analysis, err := a.analysisRepo.QueueSavedGameAnalysis(ctx, savedGame.ID, a.config.Depth, a.config.Nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.queueSavedGame(savedGame.ID); err != nil {
+		a.analysisRepo.FailSavedGameAnalysis(ctx, savedGame.ID, err.Error())
+		return nil, err
+	}
+	return analysis, nil
+}
+
+// SavedGameChanged brings the analysis of a saved game, if it has one, up to date with its edited PGN
+func (a *Analyzer) SavedGameChanged(ctx context.Context, savedGame *models.SavedGame) error {
+	analysis, err := a.analysisRepo.GetSavedGameAnalysis(ctx, savedGame.ID)
+	if err != nil || analysis == nil {
+		return err
+	}
+
+	_, err = a.RequestSavedGameAnalysis(ctx, savedGame)
+	if errors.Is(err, ErrTooManyPositions) {
+		a.analysisRepo.FailSavedGameAnalysis(ctx, savedGame.ID, err.Error())
+		return nil
+	}
+	return err
+}
+
+// queueSavedGame submits a job for the saved game, unless one is already queued or running.
+// In that case the running job goes through the PGN again when it's done, so it picks up the edit
+func (a *Analyzer) queueSavedGame(savedGameID uuid.UUID) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, ok := a.savedGames[savedGameID]; ok {
+		a.savedGames[savedGameID] = true
+		return nil
+	}
+
+	if err := a.submit(func() { a.analyseSavedGame(savedGameID) }); err != nil {
+		return err
+	}
+	a.savedGames[savedGameID] = false
+	return nil
+}
+
+func (a *Analyzer) analyseSavedGame(savedGameID uuid.UUID) {
+	ctx := context.Background()
+	for {
+		err := a.runSavedGameAnalysis(ctx, savedGameID)
+		if err != nil {
+			fmt.Printf("Analysis of saved game %s failed: %v\n", savedGameID, err)
+			a.analysisRepo.FailSavedGameAnalysis(ctx, savedGameID, err.Error())
+		}
+
+		// An edit made during a failed run can make the next one succeed, it's analysed again all the same
+		a.mutex.Lock()
+		changed := a.savedGames[savedGameID]
+		if !changed {
+			delete(a.savedGames, savedGameID)
+			a.mutex.Unlock()
+			return
+		}
+		a.savedGames[savedGameID] = false
+		a.mutex.Unlock()
+	}
+}
+
+// runSavedGameAnalysis evaluates the positions of the saved game that have no evaluation yet,
+// and drops the evaluations of positions that are no longer in its PGN
+func (a *Analyzer) runSavedGameAnalysis(ctx context.Context, savedGameID uuid.UUID) error {
+	savedGame, err := a.savedGameRepo.GetGame(ctx, savedGameID)
+	if err != nil {
+		return err
+	}
+
+	root, err := parseTree(savedGame.PGN)
+	if err != nil {
+		return err
+	}
+	fens := treePositions(root)
+	if len(fens) > a.config.MaxTreePositions {
+		return ErrTooManyPositions
+	}
+
+	analysed, err := a.analysisRepo.StartSavedGameAnalysis(ctx, savedGameID, fens)
+	if err != nil {
+		return err
+	}
+	done := make(map[string]bool, len(analysed))
+	for _, fen := range analysed {
+		done[fen] = true
+	}
+
+	for _, fen := range fens {
+		if done[fen] {
+			continue
+		}
+
+		eval, best, err := a.evaluate(ctx, fen+" 0 1")
+		if err != nil {
+			return err
+		}
+
+		position := &models.SavedGamePosition{
+			SavedGameID: savedGameID,
+			FEN:         fen,
+			BestMove:    best,
+		}
+		position.EvalCp, position.EvalMate = eval.columns()
+		if err := a.analysisRepo.AddSavedGamePosition(ctx, position); err != nil {
+			return err
+		}
+	}
+
+	return a.analysisRepo.FinishSavedGameAnalysis(ctx, savedGameID)
+}
+
+// SavedGameTree lays the evaluations of an analysis over the PGN tree of the saved game.
+// Nodes whose position isn't analysed yet are left without an evaluation
+func SavedGameTree(savedGame *models.SavedGame, analysis *models.SavedGameAnalysis) (*SavedGameAnalysis, error) {
+	root, err := parseTree(savedGame.PGN)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make(map[string]*models.SavedGamePosition, len(analysis.Positions))
+	for i := range analysis.Positions {
+		positions[analysis.Positions[i].FEN] = &analysis.Positions[i]
+	}
+
+	var build func(move *chess.Move, parent *Node, parentPosition *models.SavedGamePosition) *Node
+	build = func(move *chess.Move, parent *Node, parentPosition *models.SavedGamePosition) *Node {
+		fen := positionKey(move.Position())
+		node := &Node{FEN: fen}
+		position := positions[fen]
+		if position != nil {
+			node.EvalCp, node.EvalMate, node.BestMove = position.EvalCp, position.EvalMate, position.BestMove
+		}
+
+		if parent != nil {
+			before := move.Parent().Position()
+			node.SAN = chess.AlgebraicNotation{}.Encode(before, move)
+			node.UCI = chess.UCINotation{}.Encode(before, move)
+
+			if position != nil && parentPosition != nil {
+				white := before.Turn() == chess.White
+				classification, accuracy := rateMove(toEvaluation(parentPosition), toEvaluation(position), white, node.UCI == parentPosition.BestMove)
+				node.Classification = classification
+				node.Accuracy = &accuracy
+			}
+		}
+
+		for _, child := range move.Children() {
+			node.Children = append(node.Children, build(child, node, position))
+		}
+		return node
+	}
+
+	return &SavedGameAnalysis{SavedGameAnalysis: analysis, Tree: build(root, nil, nil)}, nil
+}
+
+func parseTree(pgn string) (*chess.Move, error) {
+	pgnOption, err := chess.PGN(strings.NewReader(pgn))
+	if err != nil {
+		return nil, err
+	}
+	return chess.NewGame(pgnOption).GetRootMove(), nil
+}
+
+// treePositions returns the distinct positions of the tree, parents before their children
+func treePositions(root *chess.Move) []string {
+	seen := make(map[string]bool)
+	var fens []string
+
+	var walk func(move *chess.Move)
+	walk = func(move *chess.Move) {
+		fen := positionKey(move.Position())
+		if !seen[fen] {
+			seen[fen] = true
+			fens = append(fens, fen)
+		}
+		for _, child := range move.Children() {
+			walk(child)
+		}
+	}
+	walk(root)
+	return fens
+}
+
+// positionKey is the FEN of a position without the move counters
+func positionKey(pos *chess.Position) string {
+	fields := strings.Fields(pos.String())
+	if len(fields) > 4 {
+		fields = fields[:4]
+	}
+	return strings.Join(fields, " ")
+}
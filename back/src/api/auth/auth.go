@@ -14,6 +14,11 @@ import (
 
 var AuthGrpc auth_grpc.AuthClient
 
+// Papel dos usuarios, consultado pelas rotas de moderacao
+var Roles interface {
+	GetUserRole(ctx context.Context, userID uuid.UUID) (string, error)
+}
+
 func ValidateWithLoginServer(r *http.Request) (*auth_grpc.UserLoggedIn, error) {
 	sessionCookie, err := r.Cookie("session_token")
 	if err != nil {
@@ -67,3 +72,23 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r.WithContext(ctx))
 	}
 }
+
+// autentica o usuario e so deixa passar moderadores, os demais recebem 403
+func ModeratorMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		clientId := r.Context().Value("clientId").(uuid.UUID)
+
+		role, err := Roles.GetUserRole(r.Context(), clientId)
+		if err != nil {
+			fmt.Println("Erro ao buscar o papel do usuario:", err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		if role != "moderator" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	})
+}
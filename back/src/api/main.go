@@ -1,6 +1,7 @@
 package main
 
 import (
+	"api/analysis"
 	"api/auth"
 	"api/matchmaking"
 	"api/routes"
@@ -8,11 +9,13 @@ import (
 	"database/repositories"
 	"fmt"
 	"net/http"
+	"os"
 	"proto-generated/auth_grpc"
 	"proto-generated/matchmaking_grpc"
 	"sync"
 	"time"
 	"utils"
+	"utils/uci"
 
 	"github.com/joho/godotenv"
 	"google.golang.org/grpc"
@@ -30,6 +33,29 @@ func main() {
 	routes.GameRepo = repositories.NewGameRepo(dbPool)
 	routes.SavedGamesRepo = repositories.NewSavedGameRepo(dbPool)
 	routes.UserRepo = repositories.NewUserRepo(dbPool)
+	routes.AnalysisRepo = repositories.NewAnalysisRepo(dbPool)
+	auth.Roles = routes.UserRepo
+
+	// A análise de partidas só fica disponível com um engine UCI instalado
+	if enginePath := os.Getenv("UCI_ENGINE_PATH"); enginePath != "" {
+		enginePool := uci.NewPool(uci.Config{
+			Path:    enginePath,
+			Options: map[string]string{"Threads": "1", "Hash": "64"},
+			Size:    2,
+		})
+		defer enginePool.Close()
+
+		routes.Analyzer = analysis.NewAnalyzer(enginePool, routes.GameRepo, routes.SavedGamesRepo, routes.AnalysisRepo, analysis.Config{
+			Workers:          2,
+			QueueSize:        100,
+			Depth:            16,
+			PositionTimeout:  30 * time.Second,
+			MaxTreePositions: 500,
+		})
+		if err := routes.Analyzer.ResumeUnfinished(context.Background()); err != nil {
+			fmt.Println("Falha ao retomar as análises pendentes:", err)
+		}
+	}
 
 	// Inicia conexão gRPC
 	mmConn := utils.RetryGRPCConnection(matchmakingGrpcAddress, grpc.WithInsecure(), time.Second)
@@ -51,6 +77,14 @@ func main() {
 	mm := matchmaking.NewMatchmakingManager(
 		mmGrpc,
 		stream,
+		routes.UserRepo,
+		repositories.NewChallengeRepo(dbPool),
+		matchmaking.Config{
+			InitialGap:      100,
+			GapPerSecond:    10,
+			MaxGap:          600,
+			ChallengeExpiry: 10 * time.Minute,
+		},
 	)
 
 	// WaitGroup apenas para o servidor WebSocket
@@ -59,10 +93,23 @@ func main() {
 
 	server_ws := http.NewServeMux()
 	server_ws.HandleFunc("/ws", auth.AuthMiddleware(mm.HandleNewConnection))
+	server_ws.HandleFunc("/matchmaking/pools", auth.AuthMiddleware(mm.HandlePoolSizes))
+	server_ws.HandleFunc("/challenge", auth.AuthMiddleware(mm.ChallengeRouter))
+	server_ws.HandleFunc("/challenge/{id}", auth.AuthMiddleware(mm.ChallengeRouter))
+	server_ws.HandleFunc("/challenge/{id}/accept", auth.AuthMiddleware(mm.ChallengeAcceptRouter))
+	server_ws.HandleFunc("/challenge/{id}/decline", auth.AuthMiddleware(mm.ChallengeDeclineRouter))
 	server_ws.HandleFunc("/savedgame", auth.AuthMiddleware(routes.SavedGameRouter))
 	server_ws.HandleFunc("/savedgame/{id}", auth.AuthMiddleware(routes.SavedGameRouter))
+	server_ws.HandleFunc("/savedgame/import", auth.AuthMiddleware(routes.SavedGameImportRouter))
+	server_ws.HandleFunc("/savedgame/{id}/analysis", auth.AuthMiddleware(routes.SavedGameAnalysisRouter))
 	server_ws.HandleFunc("/game", auth.AuthMiddleware(routes.GameRouter))
 	server_ws.HandleFunc("/game/{id}", auth.AuthMiddleware(routes.GameRouter))
+	server_ws.HandleFunc("/game/export", auth.AuthMiddleware(routes.GameExportRouter))
+	server_ws.HandleFunc("/game/live", auth.AuthMiddleware(mm.HandleLiveGames))
+	server_ws.HandleFunc("/game/{id}/moves", auth.AuthMiddleware(routes.GameMovesRouter))
+	server_ws.HandleFunc("/game/{id}/chat", auth.AuthMiddleware(routes.GameChatRouter))
+	server_ws.HandleFunc("/game/{id}/chat/moderation", auth.ModeratorMiddleware(routes.GameModerationChatRouter))
+	server_ws.HandleFunc("/game/{id}/analysis", auth.AuthMiddleware(routes.GameAnalysisRouter))
 	server_ws.HandleFunc("/userstats/{id}", auth.AuthMiddleware(routes.UserStatsRouter))
 
 	// Goroutine do WebSocket server
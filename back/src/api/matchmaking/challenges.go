@@ -0,0 +1,329 @@
+package matchmaking
+
+import (
+	"database/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/corentings/chess/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type challengeRequest struct {
+	Username string `json:"username"` // Vazio para criar um link de desafio aberto
+	Color    string `json:"color"`
+	Pool     string `json:"pool"`
+	FEN      string `json:"fen"` // Posicao inicial de uma partida tematica, vazio para a posicao da variante
+}
+
+/*
+	Desafios diretos (para um usuario especifico) e links de desafio abertos (qualquer um pode aceitar).
+	O desafio fica salvo no banco com uma data de expiracao, o alvo recebe o desafio pelo websocket do matchmaking
+	e ao aceitar a sala e criada pelo MatchMaking.RequestRoom
+*/
+
+func (mm *MatchmakingManager) ChallengeRouter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		mm.routePostChallenge(w, r)
+	case http.MethodGet:
+		mm.routeGetChallenge(w, r)
+	case http.MethodDelete:
+		mm.routeCancelChallenge(w, r)
+	default:
+		err := http.StatusMethodNotAllowed
+		http.Error(w, "Invalid Method", err)
+	}
+}
+
+func (mm *MatchmakingManager) ChallengeAcceptRouter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		mm.routeAcceptChallenge(w, r)
+	default:
+		err := http.StatusMethodNotAllowed
+		http.Error(w, "Invalid Method", err)
+	}
+}
+
+func (mm *MatchmakingManager) ChallengeDeclineRouter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		mm.routeDeclineChallenge(w, r)
+	default:
+		err := http.StatusMethodNotAllowed
+		http.Error(w, "Invalid Method", err)
+	}
+}
+
+func (mm *MatchmakingManager) routePostChallenge(w http.ResponseWriter, r *http.Request) {
+	clientID := r.Context().Value("clientId").(uuid.UUID)
+	username := r.Context().Value("username").(string)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		return
+	}
+
+	var req challengeRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		http.Error(w, "Invalid challenge", http.StatusBadRequest)
+		return
+	}
+
+	if req.Color == "" {
+		req.Color = "random"
+	}
+	if req.Color != "white" && req.Color != "black" && req.Color != "random" {
+		http.Error(w, "Color must be white, black or random", http.StatusBadRequest)
+		return
+	}
+
+	pool, err := ParsePool(req.Pool)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.FEN != "" {
+		if pool.Rated || pool.Variant != "standard" {
+			http.Error(w, "Games from a position must be casual standard games", http.StatusBadRequest)
+			return
+		}
+		if _, err := chess.FEN(req.FEN); err != nil {
+			http.Error(w, "Invalid FEN", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var targetID *uuid.UUID
+	if req.Username != "" {
+		target, err := mm.userRepo.GetUserByUsername(r.Context(), req.Username, false)
+		if err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		if target.ID == clientID {
+			http.Error(w, "Can't challenge yourself", http.StatusBadRequest)
+			return
+		}
+		targetID = &target.ID
+	}
+
+	challenge, err := mm.challengeRepo.CreateChallenge(r.Context(), clientID, targetID, req.Color, pool.String(), req.FEN, time.Now().Add(mm.config.ChallengeExpiry))
+	if err != nil {
+		http.Error(w, "Failed to create challenge", http.StatusInternalServerError)
+		return
+	}
+
+	if targetID != nil {
+		mm.sendToClient(*targetID, dataObj{
+			Type: "challengeReceived",
+			Data: map[string]interface{}{
+				"challengeId": challenge.ID,
+				"challenger":  username,
+				"color":       challenge.Color,
+				"pool":        challenge.Pool,
+				"fen":         challenge.InitialFEN,
+				"expiresAt":   challenge.ExpiresAt,
+			},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(challenge)
+}
+
+func (mm *MatchmakingManager) routeGetChallenge(w http.ResponseWriter, r *http.Request) {
+	clientID := r.Context().Value("clientId").(uuid.UUID)
+	id := r.PathValue("id")
+
+	if id == "" {
+		// desafios pendentes enviados e recebidos
+		challenges, err := mm.challengeRepo.GetPendingChallenges(r.Context(), clientID)
+		if err != nil {
+			http.Error(w, "Failed to fetch challenges", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(challenges)
+		return
+	}
+
+	// um desafio especifico, usado para abrir links de desafio
+	challenge, ok := mm.fetchChallenge(w, r)
+	if !ok {
+		return
+	}
+
+	if challenge.TargetID != nil && *challenge.TargetID != clientID && challenge.ChallengerID != clientID {
+		http.Error(w, "Challenge not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(challenge)
+}
+
+func (mm *MatchmakingManager) routeCancelChallenge(w http.ResponseWriter, r *http.Request) {
+	clientID := r.Context().Value("clientId").(uuid.UUID)
+
+	challenge, ok := mm.fetchChallenge(w, r)
+	if !ok {
+		return
+	}
+
+	if challenge.ChallengerID != clientID {
+		http.Error(w, "Only the challenger can cancel a challenge", http.StatusForbidden)
+		return
+	}
+
+	if !mm.closeChallenge(w, r, challenge, "cancelled") {
+		return
+	}
+
+	if challenge.TargetID != nil {
+		mm.sendToClient(*challenge.TargetID, dataObj{
+			Type: "challengeCancelled",
+			Data: map[string]interface{}{
+				"challengeId": challenge.ID,
+			},
+		})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (mm *MatchmakingManager) routeDeclineChallenge(w http.ResponseWriter, r *http.Request) {
+	clientID := r.Context().Value("clientId").(uuid.UUID)
+
+	challenge, ok := mm.fetchChallenge(w, r)
+	if !ok {
+		return
+	}
+
+	if challenge.TargetID == nil || *challenge.TargetID != clientID {
+		http.Error(w, "Only the challenged user can decline a challenge", http.StatusForbidden)
+		return
+	}
+
+	if !mm.closeChallenge(w, r, challenge, "declined") {
+		return
+	}
+
+	mm.sendToClient(challenge.ChallengerID, dataObj{
+		Type: "challengeDeclined",
+		Data: map[string]interface{}{
+			"challengeId": challenge.ID,
+		},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (mm *MatchmakingManager) routeAcceptChallenge(w http.ResponseWriter, r *http.Request) {
+	clientID := r.Context().Value("clientId").(uuid.UUID)
+
+	challenge, ok := mm.fetchChallenge(w, r)
+	if !ok {
+		return
+	}
+
+	if challenge.ChallengerID == clientID {
+		http.Error(w, "Can't accept your own challenge", http.StatusBadRequest)
+		return
+	}
+	if challenge.TargetID != nil && *challenge.TargetID != clientID {
+		http.Error(w, "Challenge not found", http.StatusNotFound)
+		return
+	}
+
+	pool, err := ParsePool(challenge.Pool)
+	if err != nil {
+		http.Error(w, "Invalid challenge", http.StatusInternalServerError)
+		return
+	}
+
+	if mm.safeIsPlaying(clientID) || mm.safeIsPlaying(challenge.ChallengerID) {
+		http.Error(w, "One of the players is already in a game", http.StatusConflict)
+		return
+	}
+
+	if !mm.closeChallenge(w, r, challenge, "accepted") {
+		return
+	}
+
+	roomId, white, err := mm.requestRoom(challenge.ChallengerID, clientID, challenge.Color, pool, challenge.InitialFEN)
+	if err != nil {
+		fmt.Println("Falha ao criar a sala do desafio: " + err.Error())
+		mm.challengeRepo.ReopenChallenge(r.Context(), challenge.ID)
+		http.Error(w, "Failed to create the game", http.StatusInternalServerError)
+		return
+	}
+
+	if gameID, err := uuid.Parse(roomId); err == nil {
+		mm.challengeRepo.SetChallengeGame(r.Context(), challenge.ID, gameID)
+	}
+
+	black := clientID
+	if white == clientID {
+		black = challenge.ChallengerID
+	}
+	mm.sendMatchFound(white, black, roomId, pool)
+
+	color := "black"
+	if white == clientID {
+		color = "white"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"roomId": roomId,
+		"color":  color,
+	})
+}
+
+// fetchChallenge busca o desafio do path, respondendo com o erro caso nao exista
+func (mm *MatchmakingManager) fetchChallenge(w http.ResponseWriter, r *http.Request) (*models.Challenge, bool) {
+	challengeID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid challenge id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	challenge, err := mm.challengeRepo.GetChallenge(r.Context(), challengeID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "Challenge not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch challenge", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return challenge, true
+}
+
+// closeChallenge muda o status de um desafio pendente, respondendo com o erro caso ele ja tenha sido respondido ou expirado
+func (mm *MatchmakingManager) closeChallenge(w http.ResponseWriter, r *http.Request, challenge *models.Challenge, status string) bool {
+	ok, err := mm.challengeRepo.CloseChallenge(r.Context(), challenge.ID, status)
+	if err != nil {
+		http.Error(w, "Failed to update challenge", http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		http.Error(w, "Challenge is no longer pending", http.StatusGone)
+		return false
+	}
+
+	challenge.Status = status
+	return true
+}
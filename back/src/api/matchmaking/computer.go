@@ -0,0 +1,113 @@
+package matchmaking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"proto-generated/matchmaking_grpc"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+)
+
+// Niveis do engine embutido no game server
+const (
+	minComputerLevel = 1
+	maxComputerLevel = 8
+)
+
+/*
+	Partidas contra o computador nao passam pela fila: o game server cria a sala na hora, com o engine
+	no lugar do segundo jogador. Essas partidas nunca sao rankeadas
+*/
+
+// playComputer cria uma partida contra o computador no nivel pedido, color e a cor do jogador ("white", "black" ou "random")
+func (mm *MatchmakingManager) playComputer(client clientObj, descriptor string, level int, color string) {
+	err := mm.startComputerGame(client, descriptor, level, color)
+	if err != nil {
+		fmt.Println("Falha ao criar partida contra o computador: " + err.Error())
+		client.conn.send(dataObj{
+			Type: "computerGameFailed",
+			Data: map[string]interface{}{
+				"error": err.Error(),
+			},
+		})
+	}
+}
+
+func (mm *MatchmakingManager) startComputerGame(client clientObj, descriptor string, level int, color string) error {
+	pool, err := ParsePool(descriptor)
+	if err != nil {
+		return err
+	}
+	if pool.Rated {
+		return errors.New("games against the computer can't be rated")
+	}
+
+	if level < minComputerLevel || level > maxComputerLevel {
+		return fmt.Errorf("level must be between %d and %d", minComputerLevel, maxComputerLevel)
+	}
+
+	if color == "" {
+		color = "random"
+	}
+	if color != "white" && color != "black" && color != "random" {
+		return errors.New("color must be white, black or random")
+	}
+
+	if !mm.safeClaimIdle(client.id) {
+		return errors.New("already searching or playing a game")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	roomId, white, err := mm.createRoom(ctx, &matchmaking_grpc.RequestRoomMessage{
+		PlayerId_1:       client.id.String(),
+		Rated:            false,
+		ClockBaseMs:      (time.Duration(pool.BaseMinutes) * time.Minute).Milliseconds(),
+		ClockIncrementMs: (time.Duration(pool.IncrementSeconds) * time.Second).Milliseconds(),
+		ClockDelayMs:     (time.Duration(pool.DelaySeconds) * time.Second).Milliseconds(),
+		Variant:          pool.Variant,
+		Player_1Color:    color,
+		BotLevel:         int32(level),
+		// Contra o computador não há o que esconder dos espectadores
+		SpectatorDelayMs: proto.Int64(0),
+	})
+	if err != nil {
+		mm.safeSetUserState(client.id, "idle")
+		return err
+	}
+
+	playerColor := "black"
+	if white == client.id {
+		playerColor = "white"
+	}
+
+	matchFoundObj := dataObj{
+		Type: "matchFound",
+		Data: map[string]interface{}{
+			"roomId":        roomId,
+			"pool":          pool.String(),
+			"color":         playerColor,
+			"computerLevel": level,
+		},
+	}
+	if !mm.sendToClient(client.id, matchFoundObj) {
+		fmt.Println("Falha ao enviar a sala para o jogador " + client.id.String())
+	}
+	return nil
+}
+
+// safeClaimIdle marca o jogador como "playing" caso ele esteja parado, retorna false se ele estiver na fila ou jogando
+func (mm *MatchmakingManager) safeClaimIdle(id uuid.UUID) bool {
+	mm.universalLock.Lock()
+	defer mm.universalLock.Unlock()
+
+	if state, ok := mm.usersMap[id]; ok && state != "idle" {
+		return false
+	}
+	mm.usersMap[id] = "playing"
+	return true
+}
@@ -0,0 +1,77 @@
+package matchmaking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"proto-generated/matchmaking_grpc"
+	"time"
+)
+
+type livePlayer struct {
+	ID       string   `json:"id"`
+	Username string   `json:"username"`
+	Rating   *float64 `json:"rating,omitempty"` // Rating no ritmo da partida, ausente para bots e jogadores sem rating
+}
+
+type liveGame struct {
+	RoomID      string     `json:"room_id"`
+	White       livePlayer `json:"white"`
+	Black       livePlayer `json:"black"`
+	Rated       bool       `json:"rated"`
+	Variant     string     `json:"variant"`
+	ClockBaseMs int64      `json:"clock_base_ms"`
+	IncrementMs int64      `json:"increment_ms"`
+	BotLevel    int32      `json:"bot_level,omitempty"`
+	Moves       int32      `json:"moves"`
+	Spectators  int32      `json:"spectators"`
+	StartedAt   time.Time  `json:"started_at"`
+}
+
+func toLivePlayer(player *matchmaking_grpc.LiveGamePlayer) livePlayer {
+	return livePlayer{
+		ID:       player.GetId(),
+		Username: player.GetUsername(),
+		Rating:   player.Rating,
+	}
+}
+
+// HandleLiveGames responde com as partidas em andamento que podem ser assistidas, as mais assistidas primeiro.
+// Partidas que algum dos jogadores marcou como não listadas ficam de fora
+func (mm *MatchmakingManager) HandleLiveGames(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := mm.mmGrpc.ListLiveGames(ctx, &matchmaking_grpc.ListLiveGamesMessage{})
+	if err != nil {
+		fmt.Println("Falha ao listar as partidas em andamento:", err)
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		return
+	}
+
+	games := make([]liveGame, 0, len(res.Games))
+	for _, game := range res.Games {
+		games = append(games, liveGame{
+			RoomID:      game.RoomId,
+			White:       toLivePlayer(game.White),
+			Black:       toLivePlayer(game.Black),
+			Rated:       game.Rated,
+			Variant:     game.Variant,
+			ClockBaseMs: game.ClockBaseMs,
+			IncrementMs: game.ClockIncrementMs,
+			BotLevel:    game.BotLevel,
+			Moves:       game.Moves,
+			Spectators:  game.Spectators,
+			StartedAt:   time.UnixMilli(game.StartedAtMs).UTC(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(games)
+}
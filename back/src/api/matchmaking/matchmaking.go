@@ -2,13 +2,17 @@ package matchmaking
 
 import (
 	"context"
+	"database/repositories"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"proto-generated/matchmaking_grpc"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -31,9 +35,41 @@ type ValidateResponse struct {
 	ClientId string `json:"clientId"`
 }
 
+// Tempo maximo de uma escrita no ws, um cliente lento nao segura quem mais quer escrever para ele
+const writeWait = 5 * time.Second
+
+// clientConn e a conexao ws de um jogador. O gorilla/websocket nao aceita escritas concorrentes, e escrevem nela
+// o loop de leitura, o ping, o matchmaking, o stream do game server e as rotas de desafio: toda escrita passa por send
+type clientConn struct {
+	ws        *websocket.Conn
+	writeLock sync.Mutex
+}
+
+func newClientConn(ws *websocket.Conn) *clientConn {
+	return &clientConn{ws: ws}
+}
+
+// send escreve a mensagem no ws, uma escrita por vez
+func (c *clientConn) send(obj dataObj) error {
+	jsonObj, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.ws.WriteMessage(websocket.TextMessage, jsonObj)
+}
+
+// Close pode ser chamado junto com as escritas
+func (c *clientConn) Close() error {
+	return c.ws.Close()
+}
+
 type clientObj struct {
 	id               uuid.UUID
-	ws               *websocket.Conn
+	conn             *clientConn
 	lastPing         time.Time
 	lastPingResponse time.Time
 }
@@ -48,19 +84,27 @@ type clientObj struct {
 
 type MatchmakingManager struct {
 	usersMap      map[uuid.UUID]string
-	queue         []uuid.UUID
-	clients       map[uuid.UUID]*websocket.Conn
+	queues        map[Pool][]queueEntry
+	clients       map[uuid.UUID]*clientConn
+	lastOpponent  map[uuid.UUID]uuid.UUID
 	universalLock sync.Mutex
 	mmGrpc        matchmaking_grpc.MatchMakingClient
+	userRepo      *repositories.UserRepo
+	challengeRepo *repositories.ChallengeRepo
+	config        Config
 }
 
-func NewMatchmakingManager(mmGrpc matchmaking_grpc.MatchMakingClient, mmEventsStream grpc.ServerStreamingClient[matchmaking_grpc.GameEndedEventMsg]) *MatchmakingManager {
+func NewMatchmakingManager(mmGrpc matchmaking_grpc.MatchMakingClient, mmEventsStream grpc.ServerStreamingClient[matchmaking_grpc.GameEndedEventMsg], userRepo *repositories.UserRepo, challengeRepo *repositories.ChallengeRepo, config Config) *MatchmakingManager {
 	mm := MatchmakingManager{
 		usersMap:      make(map[uuid.UUID]string),          // id -> estado
-		queue:         make([]uuid.UUID, 0),                // fila de ids
-		clients:       make(map[uuid.UUID]*websocket.Conn), // id -> conexao ws
+		queues:        make(map[Pool][]queueEntry),         // pool -> fila de jogadores buscando partida
+		clients:       make(map[uuid.UUID]*clientConn), // id -> conexao ws
+		lastOpponent:  make(map[uuid.UUID]uuid.UUID),       // id -> id do ultimo adversario
 		universalLock: sync.Mutex{},
 		mmGrpc:        mmGrpc,
+		userRepo:      userRepo,
+		challengeRepo: challengeRepo,
+		config:        config,
 	}
 
 	go mm.handleStreamMsgs(mmEventsStream)
@@ -82,25 +126,60 @@ func (mm *MatchmakingManager) handleStreamMsgs(stream grpc.ServerStreamingClient
 		p1 := uuid.MustParse(resp.Pl1)
 		p2 := uuid.MustParse(resp.Pl2)
 
-		log.Printf("Received game_ended for: %s and %s", resp.Pl1, resp.Pl2)
+		// Salas abertas pelo proprio game server (revanches) colocam os jogadores em partida de novo
+		state := "idle"
+		if resp.Event == "game_started" {
+			state = "playing"
+		}
+
+		log.Printf("Received %s for: %s and %s", resp.Event, resp.Pl1, resp.Pl2)
 		mm.universalLock.Lock()
 		_, ok := mm.usersMap[p1]
 		_, ok2 := mm.usersMap[p2]
 
 		if ok {
-			mm.usersMap[p1] = "idle"
+			mm.usersMap[p1] = state
 		}
 
 		if ok2 {
-			mm.usersMap[p2] = "idle"
+			mm.usersMap[p2] = state
 		}
 
 		mm.universalLock.Unlock()
+
+		// Let both clients know the room they were sent to is gone
+		if resp.Result == "aborted" {
+			mm.notifyGameAborted(p1, resp.RoomId)
+			mm.notifyGameAborted(p2, resp.RoomId)
+		}
+	}
+}
+
+func (mm *MatchmakingManager) notifyGameAborted(id uuid.UUID, roomId string) {
+	gameAbortedObj := dataObj{
+		Type: "gameAborted",
+		Data: map[string]interface{}{
+			"roomId": roomId,
+		},
+	}
+
+	if !mm.sendToClient(id, gameAbortedObj) {
+		fmt.Println("Falha ao notificar o jogador sobre a partida abortada")
 	}
 }
 
+// sendToClient envia uma mensagem ao jogador se ele estiver conectado, retorna false caso nao tenha conseguido
+func (mm *MatchmakingManager) sendToClient(id uuid.UUID, obj dataObj) bool {
+	conn, ok := mm.safeGetClient(id)
+	if !ok {
+		return false
+	}
+
+	return conn.send(obj) == nil
+}
+
 // Usa um unico lock para todo o processo, evita que a go routine seja chamada entre operacoes.
-func (mm *MatchmakingManager) safeRegisterMatchRequest(client clientObj) bool {
+func (mm *MatchmakingManager) safeRegisterMatchRequest(client clientObj, pool Pool, strength float64, rematch bool) bool {
 	mm.universalLock.Lock()
 	defer mm.universalLock.Unlock()
 
@@ -110,13 +189,73 @@ func (mm *MatchmakingManager) safeRegisterMatchRequest(client clientObj) bool {
 		return false
 	}
 
-	fmt.Println("Registering " + client.id.String() + " in queue")
+	fmt.Println("Registering " + client.id.String() + " in queue " + pool.String())
 	mm.usersMap[client.id] = "searching"
-	mm.clients[client.id] = client.ws
-	mm.queue = append(mm.queue, client.id)
+	mm.clients[client.id] = client.conn
+	mm.removeFromQueuesNoLock(client.id)
+	mm.queues[pool] = append(mm.queues[pool], queueEntry{
+		id:         client.id,
+		strength:   strength,
+		enqueuedAt: time.Now(),
+		rematch:    rematch,
+	})
 	return true
 }
 
+// removeFromQueuesNoLock tira das filas entradas antigas do jogador (ex: ele saiu da fila e entrou de novo em outro pool)
+func (mm *MatchmakingManager) removeFromQueuesNoLock(id uuid.UUID) {
+	for pool, entries := range mm.queues {
+		queue := entries[:0]
+		for _, entry := range entries {
+			if entry.id != id {
+				queue = append(queue, entry)
+			}
+		}
+		mm.queues[pool] = queue
+	}
+}
+
+// safePoolSizes retorna quantos jogadores estao buscando partida em cada pool
+func (mm *MatchmakingManager) safePoolSizes() map[string]int {
+	mm.universalLock.Lock()
+	defer mm.universalLock.Unlock()
+
+	sizes := make(map[string]int)
+	for pool, entries := range mm.queues {
+		for _, entry := range entries {
+			if mm.usersMap[entry.id] == "searching" {
+				sizes[pool.String()]++
+			}
+		}
+	}
+	return sizes
+}
+
+// HandlePoolSizes responde com o numero de jogadores em cada fila, ex: {"3+2 rated": 4, "10+0 casual": 1}
+func (mm *MatchmakingManager) HandlePoolSizes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mm.safePoolSizes())
+}
+
+// userStrength estima a forca do jogador a partir do historico de vitorias/empates/derrotas
+func (mm *MatchmakingManager) userStrength(id uuid.UUID) float64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := mm.userRepo.GetUserWithStats(ctx, id)
+	if err != nil {
+		fmt.Println("Falha ao buscar estatisticas de " + id.String() + ": " + err.Error())
+		return defaultStrength
+	}
+
+	return estimateStrength(user.Stats)
+}
+
 func (mm *MatchmakingManager) safeSetUserState(c uuid.UUID, state string) {
 	mm.universalLock.Lock()
 	defer mm.universalLock.Unlock()
@@ -131,17 +270,30 @@ func (mm *MatchmakingManager) safeSetUserState(c uuid.UUID, state string) {
 	mm.usersMap[c] = state
 }
 
-func (mm *MatchmakingManager) safeSetClient(id uuid.UUID, ws *websocket.Conn) {
+func (mm *MatchmakingManager) safeIsPlaying(c uuid.UUID) bool {
 	mm.universalLock.Lock()
 	defer mm.universalLock.Unlock()
-	mm.clients[id] = ws
+	return mm.usersMap[c] == "playing"
 }
 
-func (mm *MatchmakingManager) safeGetClient(id uuid.UUID) (*websocket.Conn, bool) {
+func (mm *MatchmakingManager) safeSetLastOpponents(player1 uuid.UUID, player2 uuid.UUID) {
 	mm.universalLock.Lock()
 	defer mm.universalLock.Unlock()
-	ws, ok := mm.clients[id]
-	return ws, ok
+	mm.lastOpponent[player1] = player2
+	mm.lastOpponent[player2] = player1
+}
+
+func (mm *MatchmakingManager) safeSetClient(id uuid.UUID, conn *clientConn) {
+	mm.universalLock.Lock()
+	defer mm.universalLock.Unlock()
+	mm.clients[id] = conn
+}
+
+func (mm *MatchmakingManager) safeGetClient(id uuid.UUID) (*clientConn, bool) {
+	mm.universalLock.Lock()
+	defer mm.universalLock.Unlock()
+	conn, ok := mm.clients[id]
+	return conn, ok
 }
 
 // executa a funcao de matchmaking periodicamente para encontrar partidas entre dois usuarios
@@ -153,94 +305,165 @@ func (mm *MatchmakingManager) matchmakingLoop() {
 }
 
 func (mm *MatchmakingManager) matchmaking() {
+	for _, pool := range mm.safePools() {
+		mm.matchmakingPool(pool)
+	}
+}
+
+func (mm *MatchmakingManager) safePools() []Pool {
 	mm.universalLock.Lock()
+	defer mm.universalLock.Unlock()
 
-	if len(mm.queue) < 2 {
-		mm.universalLock.Unlock()
-		return
+	pools := make([]Pool, 0, len(mm.queues))
+	for pool := range mm.queues {
+		pools = append(pools, pool)
 	}
+	return pools
+}
 
-	tempMatch := make([]uuid.UUID, 0, 2)
-
-	for len(tempMatch) < 2 && len(mm.queue) > 0 {
-		client := mm.queue[0]
-		mm.queue = mm.queue[1:]
+func (mm *MatchmakingManager) matchmakingPool(pool Pool) {
+	mm.universalLock.Lock()
 
-		state, exists := mm.usersMap[client]
-		if !exists || state != "searching" {
-			fmt.Println(`Client with id ` + client.String() + " is already searching!")
-			continue
+	// descarta quem saiu da fila ou ja esta jogando
+	queue := mm.queues[pool][:0]
+	for _, entry := range mm.queues[pool] {
+		state, exists := mm.usersMap[entry.id]
+		if exists && state == "searching" {
+			queue = append(queue, entry)
 		}
+	}
 
-		fmt.Println("added " + client.String() + " to escrow match room")
-		tempMatch = append(tempMatch, client)
+	if len(queue) == 0 {
+		delete(mm.queues, pool)
+		mm.universalLock.Unlock()
+		return
 	}
+	mm.queues[pool] = queue
 
-	if len(tempMatch) == 0 {
+	if len(queue) < 2 {
 		mm.universalLock.Unlock()
 		return
 	}
 
-	if len(tempMatch) < 2 || tempMatch[0] == tempMatch[1] {
-		// cria nova fila: tempMatch + queue
-		mm.queue = append(mm.queue, tempMatch[0])
+	pairs := findPairs(queue, mm.lastOpponent, mm.config, time.Now())
+	if len(pairs) == 0 {
 		mm.universalLock.Unlock()
 		return
 	}
 
-	// Tenho 2 jogadores válidos
-	player1 := tempMatch[0]
-	player2 := tempMatch[1]
+	matched := make(map[int]bool)
+	matches := make([][2]uuid.UUID, 0, len(pairs))
+	for _, pair := range pairs {
+		matched[pair[0]] = true
+		matched[pair[1]] = true
+		matches = append(matches, [2]uuid.UUID{queue[pair[0]].id, queue[pair[1]].id})
+	}
+
+	remaining := make([]queueEntry, 0, len(queue)-len(matched))
+	for i, entry := range queue {
+		if !matched[i] {
+			remaining = append(remaining, entry)
+		}
+	}
+	mm.queues[pool] = remaining
 
 	mm.universalLock.Unlock()
 
+	for _, match := range matches {
+		fmt.Println("added " + match[0].String() + " and " + match[1].String() + " to escrow match room (" + pool.String() + ")")
+		mm.startMatch(match[0], match[1], pool)
+	}
+}
+
+// startMatch pede uma sala ao game server e avisa os dois jogadores
+func (mm *MatchmakingManager) startMatch(player1 uuid.UUID, player2 uuid.UUID, pool Pool) {
+	roomId, white, err := mm.requestRoom(player1, player2, "balanced", pool, "")
+	if err != nil {
+		// Os jogadores ja sairam da fila, voltam a ficar livres para procurar outra partida
+		fmt.Println("Falha ao criar a sala: " + err.Error())
+		mm.safeSetUserState(player1, "idle")
+		mm.safeSetUserState(player2, "idle")
+		return
+	}
+
+	black := player2
+	if white == player2 {
+		black = player1
+	}
+	mm.sendMatchFound(white, black, roomId, pool)
+}
+
+// requestRoom cria a sala no game server e marca os dois jogadores como "playing".
+// player1Color e a cor pedida para o player1 ("white", "black", "random" ou "balanced"), retorna o id da sala e quem ficou de brancas.
+// Com initialFEN a partida comeca dessa posicao em vez da variante da pool
+func (mm *MatchmakingManager) requestRoom(player1 uuid.UUID, player2 uuid.UUID, player1Color string, pool Pool, initialFEN string) (string, uuid.UUID, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	room, err := mm.mmGrpc.RequestRoom(ctx,
+	variant := pool.Variant
+	if initialFEN != "" {
+		variant = "fromposition"
+	}
+
+	roomId, white, err := mm.createRoom(ctx,
 		&matchmaking_grpc.RequestRoomMessage{
-			PlayerId_1: player1.String(),
-			PlayerId_2: player2.String(),
+			PlayerId_1:       player1.String(),
+			PlayerId_2:       player2.String(),
+			Rated:            pool.Rated,
+			ClockBaseMs:      (time.Duration(pool.BaseMinutes) * time.Minute).Milliseconds(),
+			ClockIncrementMs: (time.Duration(pool.IncrementSeconds) * time.Second).Milliseconds(),
+			ClockDelayMs:     (time.Duration(pool.DelaySeconds) * time.Second).Milliseconds(),
+			Variant:          variant,
+			Player_1Color:    player1Color,
+			InitialFen:       initialFEN,
 		})
-
 	if err != nil {
-		fmt.Printf("%v\n", err)
-		panic("Error acquiring a room")
-	}
-
-	if room.ErrorMsg != nil {
-		println("Error: ", *room.ErrorMsg)
-		return
+		return "", uuid.Nil, err
 	}
 
 	mm.safeSetUserState(player1, "playing")
 	mm.safeSetUserState(player2, "playing")
-	println("Room: " + room.RoomId)
+	mm.safeSetLastOpponents(player1, player2)
+	return roomId, white, nil
+}
 
-	matchFoundObj := dataObj{
-		Type: "matchFound",
-		Data: map[string]interface{}{
-			"roomId": room.RoomId,
-		},
+// createRoom faz o pedido de sala ao game server, retorna o id da sala e quem ficou de brancas
+func (mm *MatchmakingManager) createRoom(ctx context.Context, req *matchmaking_grpc.RequestRoomMessage) (string, uuid.UUID, error) {
+	room, err := mm.mmGrpc.RequestRoom(ctx, req)
+	if err != nil {
+		return "", uuid.Nil, err
 	}
 
-	jsonObj, _ := json.Marshal(matchFoundObj)
-
-	player1_ws, ok1 := mm.safeGetClient(player1)
-	player2_ws, ok2 := mm.safeGetClient(player2)
-
-	// TODO: enviar uma mensagem aos jogadores ou algo do tipo
-	if !ok1 || !ok2 {
-		fmt.Println("Falha ao recuperar cliente (ws) dos jogadores")
-		return
+	if room.ErrorMsg != nil {
+		return "", uuid.Nil, errors.New(*room.ErrorMsg)
 	}
 
-	if err := player1_ws.WriteMessage(websocket.TextMessage, jsonObj); err != nil {
-		fmt.Println("Falha ao enviar a sala para o player1")
+	white, err := uuid.Parse(room.WhiteId)
+	if err != nil {
+		return "", uuid.Nil, err
 	}
 
-	if err := player2_ws.WriteMessage(websocket.TextMessage, jsonObj); err != nil {
-		fmt.Println("Falha ao enviar a sala para o player1")
+	return room.RoomId, white, nil
+}
+
+// sendMatchFound avisa os dois jogadores da sala criada, cada um com a sua cor
+func (mm *MatchmakingManager) sendMatchFound(white uuid.UUID, black uuid.UUID, roomId string, pool Pool) {
+	for _, player := range []struct {
+		id    uuid.UUID
+		color string
+	}{{white, "white"}, {black, "black"}} {
+		matchFoundObj := dataObj{
+			Type: "matchFound",
+			Data: map[string]interface{}{
+				"roomId": roomId,
+				"pool":   pool.String(),
+				"color":  player.color,
+			},
+		}
+
+		if !mm.sendToClient(player.id, matchFoundObj) {
+			fmt.Println("Falha ao enviar a sala para o jogador " + player.id.String())
+		}
 	}
 }
 
@@ -262,35 +485,43 @@ func (mm *MatchmakingManager) HandleNewConnection(w http.ResponseWriter, r *http
 	}
 
 	fmt.Println("Client conectado:", clientId, username)
-	mm.safeSetClient(clientId, ws)
+	conn := newClientConn(ws)
+	mm.safeSetClient(clientId, conn)
 	mm.safeSetUserState(clientId, "idle")
 
 	var client clientObj
 	client.id = clientId
-	client.ws = ws
+	client.conn = conn
 	client.lastPing = time.Now()
 	client.lastPingResponse = time.Now()
 
+	// A forca vem do banco, e o loop de leitura nao espera por ele: e buscada antes do loop e atualizada
+	// em segundo plano a cada entrada na fila, valendo a partir da proxima
+	var strength atomic.Uint64
+	strength.Store(math.Float64bits(mm.userStrength(client.id)))
+	refreshStrength := func() {
+		strength.Store(math.Float64bits(mm.userStrength(client.id)))
+	}
+
 	go func() {
 		for {
 			if client.lastPing.Sub(client.lastPingResponse) > 3*time.Second {
-				client.ws.Close()
+				client.conn.Close()
 				conn, ok := mm.safeGetClient(client.id)
-				if ok && conn == client.ws {
+				if ok && conn == client.conn {
 					mm.safeSetUserState(client.id, "idle")
 				}
 				break
 			}
 
 			time.Sleep(time.Second)
-			pingMessage, _ := json.Marshal(dataObj{
+			err := client.conn.send(dataObj{
 				Type: "ping",
 				Data: map[string]interface{}{},
 			})
-			err := client.ws.WriteMessage(websocket.TextMessage, pingMessage)
 			if err != nil {
 				conn, ok := mm.safeGetClient(client.id)
-				if ok && conn == client.ws {
+				if ok && conn == client.conn {
 					mm.safeSetUserState(client.id, "idle")
 				}
 				break
@@ -305,7 +536,7 @@ func (mm *MatchmakingManager) HandleNewConnection(w http.ResponseWriter, r *http
 		err := ws.ReadJSON(&obj)
 		if err != nil {
 			conn, ok := mm.safeGetClient(client.id)
-			if ok && conn == client.ws {
+			if ok && conn == client.conn {
 				mm.safeSetUserState(client.id, "idle")
 			}
 			return
@@ -313,7 +544,28 @@ func (mm *MatchmakingManager) HandleNewConnection(w http.ResponseWriter, r *http
 
 		if obj.Type == "joinQueue" {
 			fmt.Println("Processing " + client.id.String() + " request")
-			mm.safeRegisterMatchRequest(client)
+			descriptor, _ := obj.Data["pool"].(string)
+			pool, err := ParsePool(descriptor)
+			if err != nil {
+				client.conn.send(dataObj{
+					Type: "invalidPool",
+					Data: map[string]interface{}{
+						"error": err.Error(),
+					},
+				})
+				continue
+			}
+
+			rematch, _ := obj.Data["rematch"].(bool)
+			mm.safeRegisterMatchRequest(client, pool, math.Float64frombits(strength.Load()), rematch)
+			go refreshStrength()
+		}
+
+		if obj.Type == "playComputer" {
+			descriptor, _ := obj.Data["pool"].(string)
+			level, _ := obj.Data["level"].(float64)
+			color, _ := obj.Data["color"].(string)
+			mm.playComputer(client, descriptor, int(level), color)
 		}
 
 		if obj.Type == "leaveQueue" {
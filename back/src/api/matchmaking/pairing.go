@@ -0,0 +1,107 @@
+package matchmaking
+
+import (
+	"database/models"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultStrength = 1500.0
+
+type Config struct {
+	InitialGap   float64 // Strength gap accepted as soon as a player joins the queue
+	GapPerSecond float64 // How much the accepted gap grows for every second waited
+	MaxGap       float64 // The accepted gap never grows beyond this
+
+	ChallengeExpiry time.Duration // How long a challenge waits for an answer
+}
+
+type queueEntry struct {
+	id         uuid.UUID
+	strength   float64
+	enqueuedAt time.Time
+	rematch    bool // The player asked to play again against the last opponent
+}
+
+// estimateStrength turns the win/draw/loss history of a player into an Elo-like number.
+// The score is shrunk towards 50% by a few virtual draws, so players with few games stay close to the default
+func estimateStrength(stats *models.UserStats) float64 {
+	if stats == nil || stats.GamesPlayed == 0 {
+		return defaultStrength
+	}
+
+	const virtualDraws = 10.0
+	score := (float64(stats.Wins) + 0.5*float64(stats.Draws) + 0.5*virtualDraws) / (float64(stats.GamesPlayed) + virtualDraws)
+	score = math.Min(math.Max(score, 0.01), 0.99)
+
+	return defaultStrength + 400*math.Log10(score/(1-score))
+}
+
+// acceptedGap returns how far from its own strength a player accepts an opponent after waiting since enqueuedAt
+func (c Config) acceptedGap(enqueuedAt time.Time, now time.Time) float64 {
+	waited := now.Sub(enqueuedAt).Seconds()
+	return math.Min(c.MaxGap, c.InitialGap+c.GapPerSecond*math.Max(0, waited))
+}
+
+// findPairs chooses which entries of the queue should play each other, returning pairs of indexes into entries.
+// Players who waited longer choose first and get the closest opponent within both accepted gaps.
+// A player is never paired again with its last opponent unless both asked for a rematch, in which case
+// they are paired regardless of strength
+func findPairs(entries []queueEntry, lastOpponent map[uuid.UUID]uuid.UUID, config Config, now time.Time) [][2]int {
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return entries[order[a]].enqueuedAt.Before(entries[order[b]].enqueuedAt)
+	})
+
+	paired := make([]bool, len(entries))
+	pairs := make([][2]int, 0)
+
+	for _, i := range order {
+		if paired[i] {
+			continue
+		}
+		a := entries[i]
+
+		best := -1
+		bestGap := math.Inf(1)
+		for _, j := range order {
+			if j == i || paired[j] {
+				continue
+			}
+			b := entries[j]
+			if a.id == b.id {
+				continue
+			}
+
+			gap := math.Abs(a.strength - b.strength)
+			isRematch := lastOpponent[a.id] == b.id || lastOpponent[b.id] == a.id
+			if isRematch {
+				if !a.rematch || !b.rematch {
+					continue
+				}
+				gap = -1
+			} else if gap > config.acceptedGap(a.enqueuedAt, now) || gap > config.acceptedGap(b.enqueuedAt, now) {
+				continue
+			}
+
+			if gap < bestGap {
+				best = j
+				bestGap = gap
+			}
+		}
+
+		if best != -1 {
+			paired[i] = true
+			paired[best] = true
+			pairs = append(pairs, [2]int{i, best})
+		}
+	}
+
+	return pairs
+}
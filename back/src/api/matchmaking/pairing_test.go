@@ -0,0 +1,187 @@
+package matchmaking
+
+import (
+	"database/models"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var testConfig = Config{
+	InitialGap:   100,
+	GapPerSecond: 10,
+	MaxGap:       300,
+}
+
+func TestEstimateStrength(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats *models.UserStats
+		want  float64
+	}{
+		{"no stats", nil, 1500},
+		{"no games", &models.UserStats{}, 1500},
+		{"even score", &models.UserStats{Wins: 5, Losses: 5, GamesPlayed: 10}, 1500},
+		{"only draws", &models.UserStats{Draws: 20, GamesPlayed: 20}, 1500},
+		{"all wins", &models.UserStats{Wins: 10, GamesPlayed: 10}, 1500 + 400*math.Log10(3)},
+		{"all losses", &models.UserStats{Losses: 10, GamesPlayed: 10}, 1500 - 400*math.Log10(3)},
+		{"score is capped", &models.UserStats{Wins: 1000, GamesPlayed: 1000}, 1500 + 400*math.Log10(99)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := estimateStrength(tt.stats)
+			if math.Abs(got-tt.want) > 0.01 {
+				t.Errorf("estimateStrength() = %.2f, want %.2f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcceptedGap(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		waited time.Duration
+		want   float64
+	}{
+		{"just joined", 0, 100},
+		{"waited a bit", 5 * time.Second, 150},
+		{"reaches the cap", 20 * time.Second, 300},
+		{"never grows past the cap", time.Hour, 300},
+		{"clock skew", -5 * time.Second, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := testConfig.acceptedGap(now.Add(-tt.waited), now)
+			if got != tt.want {
+				t.Errorf("acceptedGap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindPairs(t *testing.T) {
+	now := time.Now()
+	ids := make([]uuid.UUID, 4)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+
+	entry := func(player int, strength float64, waited time.Duration, rematch bool) queueEntry {
+		return queueEntry{
+			id:         ids[player],
+			strength:   strength,
+			enqueuedAt: now.Add(-waited),
+			rematch:    rematch,
+		}
+	}
+
+	tests := []struct {
+		name         string
+		entries      []queueEntry
+		lastOpponent map[uuid.UUID]uuid.UUID
+		want         [][2]int
+	}{
+		{
+			name:    "close players are paired right away",
+			entries: []queueEntry{entry(0, 1500, 0, false), entry(1, 1550, 0, false)},
+			want:    [][2]int{{0, 1}},
+		},
+		{
+			name:    "gap too wide for new players",
+			entries: []queueEntry{entry(0, 1500, 0, false), entry(1, 1700, 0, false)},
+			want:    [][2]int{},
+		},
+		{
+			name:    "window widens while both wait",
+			entries: []queueEntry{entry(0, 1500, 15*time.Second, false), entry(1, 1700, 15*time.Second, false)},
+			want:    [][2]int{{0, 1}},
+		},
+		{
+			name:    "both players must accept the gap",
+			entries: []queueEntry{entry(0, 1500, 15*time.Second, false), entry(1, 1700, 0, false)},
+			want:    [][2]int{},
+		},
+		{
+			name:    "gap within the cap after a long wait",
+			entries: []queueEntry{entry(0, 1500, time.Hour, false), entry(1, 1790, time.Hour, false)},
+			want:    [][2]int{{0, 1}},
+		},
+		{
+			name:    "gap over the cap is never accepted",
+			entries: []queueEntry{entry(0, 1500, time.Hour, false), entry(1, 1850, time.Hour, false)},
+			want:    [][2]int{},
+		},
+		{
+			name: "longest waiting player gets the closest opponent",
+			entries: []queueEntry{
+				entry(0, 1560, 0, false),
+				entry(1, 1500, 10*time.Second, false),
+				entry(2, 1520, 0, false),
+				entry(3, 1580, 0, false),
+			},
+			want: [][2]int{{1, 2}, {0, 3}},
+		},
+		{
+			name:    "same user is never paired with itself",
+			entries: []queueEntry{entry(0, 1500, 0, false), entry(0, 1500, 0, false)},
+			want:    [][2]int{},
+		},
+		{
+			name:         "last opponents are not paired again",
+			entries:      []queueEntry{entry(0, 1500, 0, false), entry(1, 1500, 0, false)},
+			lastOpponent: map[uuid.UUID]uuid.UUID{ids[0]: ids[1], ids[1]: ids[0]},
+			want:         [][2]int{},
+		},
+		{
+			name:         "last opponent of either side counts",
+			entries:      []queueEntry{entry(0, 1500, 0, false), entry(1, 1500, 0, false)},
+			lastOpponent: map[uuid.UUID]uuid.UUID{ids[1]: ids[0]},
+			want:         [][2]int{},
+		},
+		{
+			name:         "last opponent is skipped for another player",
+			entries:      []queueEntry{entry(0, 1500, 0, false), entry(1, 1510, 0, false), entry(2, 1560, 0, false)},
+			lastOpponent: map[uuid.UUID]uuid.UUID{ids[0]: ids[1], ids[1]: ids[0]},
+			want:         [][2]int{{0, 2}},
+		},
+		{
+			name:         "rematch needs both players to ask",
+			entries:      []queueEntry{entry(0, 1500, 0, true), entry(1, 1500, 0, false)},
+			lastOpponent: map[uuid.UUID]uuid.UUID{ids[0]: ids[1], ids[1]: ids[0]},
+			want:         [][2]int{},
+		},
+		{
+			name:         "mutual rematch ignores the gap",
+			entries:      []queueEntry{entry(0, 1200, 0, true), entry(1, 1800, 0, true)},
+			lastOpponent: map[uuid.UUID]uuid.UUID{ids[0]: ids[1], ids[1]: ids[0]},
+			want:         [][2]int{{0, 1}},
+		},
+		{
+			name:         "mutual rematch comes before a closer opponent",
+			entries:      []queueEntry{entry(0, 1500, 0, true), entry(1, 1650, 0, true), entry(2, 1500, 0, false)},
+			lastOpponent: map[uuid.UUID]uuid.UUID{ids[0]: ids[1], ids[1]: ids[0]},
+			want:         [][2]int{{0, 1}},
+		},
+		{
+			name:         "rematch flag alone doesn't widen the gap",
+			entries:      []queueEntry{entry(0, 1500, 0, true), entry(1, 1800, 0, true)},
+			lastOpponent: map[uuid.UUID]uuid.UUID{},
+			want:         [][2]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findPairs(tt.entries, tt.lastOpponent, testConfig, now)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findPairs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package matchmaking
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Variants the game server knows how to play
+var supportedVariants = map[string]bool{
+	"standard": true,
+	"chess960": true,
+}
+
+// Pool describes the kind of game a player is looking for, each pool has its own queue
+type Pool struct {
+	BaseMinutes      int
+	IncrementSeconds int
+	DelaySeconds     int
+	Rated            bool
+	Variant          string
+}
+
+var defaultPool = Pool{
+	BaseMinutes:      10,
+	IncrementSeconds: 0,
+	DelaySeconds:     0,
+	Rated:            false,
+	Variant:          "standard",
+}
+
+// ParsePool reads a pool descriptor such as "3+2 rated", "10+0 casual", "5+0 d3" (3 seconds of delay) or "chess960".
+// Anything left out of the descriptor takes the value of the default pool (10+0 casual standard)
+func ParsePool(descriptor string) (Pool, error) {
+	pool := defaultPool
+
+	for _, token := range strings.Fields(strings.ToLower(descriptor)) {
+		switch {
+		case token == "rated":
+			pool.Rated = true
+		case token == "casual":
+			pool.Rated = false
+		case strings.Contains(token, "+"):
+			base, increment, _ := strings.Cut(token, "+")
+			baseMinutes, err := strconv.Atoi(base)
+			if err != nil || baseMinutes <= 0 || baseMinutes > 180 {
+				return Pool{}, fmt.Errorf("invalid base time: %s", base)
+			}
+			incrementSeconds, err := strconv.Atoi(increment)
+			if err != nil || incrementSeconds < 0 || incrementSeconds > 180 {
+				return Pool{}, fmt.Errorf("invalid increment: %s", increment)
+			}
+			pool.BaseMinutes = baseMinutes
+			pool.IncrementSeconds = incrementSeconds
+		case strings.HasPrefix(token, "d"):
+			delaySeconds, err := strconv.Atoi(token[1:])
+			if err != nil || delaySeconds < 0 || delaySeconds > 60 {
+				return Pool{}, fmt.Errorf("invalid delay: %s", token[1:])
+			}
+			pool.DelaySeconds = delaySeconds
+		case supportedVariants[token]:
+			pool.Variant = token
+		default:
+			return Pool{}, errors.New("unknown pool option: " + token)
+		}
+	}
+
+	return pool, nil
+}
+
+// String returns the canonical descriptor of the pool, used as the key of its queue
+func (p Pool) String() string {
+	descriptor := fmt.Sprintf("%d+%d", p.BaseMinutes, p.IncrementSeconds)
+	if p.DelaySeconds > 0 {
+		descriptor += fmt.Sprintf(" d%d", p.DelaySeconds)
+	}
+	if p.Rated {
+		descriptor += " rated"
+	} else {
+		descriptor += " casual"
+	}
+	if p.Variant != "standard" {
+		descriptor += " " + p.Variant
+	}
+	return descriptor
+}
@@ -0,0 +1,198 @@
+package routes
+
+import (
+	"api/analysis"
+	"database/models"
+	"database/repositories"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var AnalysisRepo *repositories.AnalysisRepo
+
+// Analyzer is nil when no engine is configured, analyses can then be read but not requested
+var Analyzer *analysis.Analyzer
+
+func routePostGameAnalysis(w http.ResponseWriter, r *http.Request) {
+	clientID := r.Context().Value("clientId").(uuid.UUID)
+
+	gameID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if Analyzer == nil {
+		http.Error(w, "Analysis is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	game, err := GameRepo.GetGame(r.Context(), gameID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if game == nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+	if game.Status != "ended" || game.Result == "aborted" {
+		http.Error(w, "Only finished games can be analysed", http.StatusBadRequest)
+		return
+	}
+
+	moves, err := GameRepo.GetGameMoves(r.Context(), gameID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	gameAnalysis, err := Analyzer.RequestGameAnalysis(r.Context(), gameID, len(moves), clientID)
+	if errors.Is(err, analysis.ErrQueueFull) {
+		http.Error(w, "Too many analyses queued, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(gameAnalysis)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(jsonData)
+}
+
+func routeGetGameAnalysis(w http.ResponseWriter, r *http.Request) {
+	gameID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	gameAnalysis, err := AnalysisRepo.GetGameAnalysis(r.Context(), gameID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if gameAnalysis == nil {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+
+	jsonData, err := json.Marshal(gameAnalysis)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(jsonData)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+	}
+}
+
+// getOwnSavedGame returns the saved game of the path if it belongs to the client, writing the error response otherwise
+func getOwnSavedGame(w http.ResponseWriter, r *http.Request) *models.SavedGame {
+	clientID := r.Context().Value("clientId").(uuid.UUID)
+
+	savedGameID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return nil
+	}
+
+	savedGame, err := SavedGamesRepo.GetGame(r.Context(), savedGameID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && savedGame.UserID != clientID) {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return nil
+	}
+	return savedGame
+}
+
+func routePostSavedGameAnalysis(w http.ResponseWriter, r *http.Request) {
+	savedGame := getOwnSavedGame(w, r)
+	if savedGame == nil {
+		return
+	}
+
+	if Analyzer == nil {
+		http.Error(w, "Analysis is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	savedGameAnalysis, err := Analyzer.RequestSavedGameAnalysis(r.Context(), savedGame)
+	if errors.Is(err, analysis.ErrTooManyPositions) {
+		http.Error(w, "The game has too many variations to be analysed", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, analysis.ErrQueueFull) {
+		http.Error(w, "Too many analyses queued, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	tree, err := analysis.SavedGameTree(savedGame, savedGameAnalysis)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(tree)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(jsonData)
+}
+
+func routeGetSavedGameAnalysis(w http.ResponseWriter, r *http.Request) {
+	savedGame := getOwnSavedGame(w, r)
+	if savedGame == nil {
+		return
+	}
+
+	savedGameAnalysis, err := AnalysisRepo.GetSavedGameAnalysis(r.Context(), savedGame.ID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if savedGameAnalysis == nil {
+		http.Error(w, "Analysis not found", http.StatusNotFound)
+		return
+	}
+
+	tree, err := analysis.SavedGameTree(savedGame, savedGameAnalysis)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(tree)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(jsonData)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+	}
+}
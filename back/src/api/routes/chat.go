@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"database/models"
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// routeGetGameChat returns the chat the players of a game had, in the order it was sent. Only the players can
+// read it, and they get their own channel only, as in the game. Moderators read both channels through
+// routeGetGameModerationChat
+func routeGetGameChat(w http.ResponseWriter, r *http.Request) {
+	clientID := r.Context().Value("clientId").(uuid.UUID)
+
+	gameID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	game, err := GameRepo.GetGame(r.Context(), gameID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if game == nil || (game.WhiteID != clientID && game.BlackID != clientID) {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	messages, err := GameRepo.GetChatMessages(r.Context(), gameID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	chat := make([]models.ChatMessage, 0, len(messages))
+	for _, message := range messages {
+		if message.Channel == "player" {
+			chat = append(chat, message)
+		}
+	}
+
+	jsonData, err := json.Marshal(chat)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(jsonData)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+	}
+}
+
+// routeGetGameModerationChat returns the whole chat of a game, players' and spectators' channels, in the order it
+// was sent. The route is behind the moderator check, so anyone reaching it can read any game
+func routeGetGameModerationChat(w http.ResponseWriter, r *http.Request) {
+	gameID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	game, err := GameRepo.GetGame(r.Context(), gameID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if game == nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	messages, err := GameRepo.GetChatMessages(r.Context(), gameID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if messages == nil {
+		messages = []models.ChatMessage{}
+	}
+
+	jsonData, err := json.Marshal(messages)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(jsonData)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+	}
+}
@@ -1,9 +1,15 @@
 package routes
 
 import (
+	"database/models"
 	"database/repositories"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -11,6 +17,11 @@ import (
 var GameRepo *repositories.GameRepo
 
 func routeGetGame(w http.ResponseWriter, r *http.Request) {
+	if id, ok := strings.CutSuffix(r.PathValue("id"), ".pgn"); ok {
+		routeGetGamePGN(w, r, id)
+		return
+	}
+
 	gameID, err := uuid.Parse(r.PathValue("id"))
 
 	if err == nil {
@@ -37,18 +48,39 @@ func routeGetGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, err := uuid.Parse(r.URL.Query().Get("user"))
+	filter, err := parseGameFilter(r.URL.Query())
 	if err != nil {
-		http.Error(w, "Bad request", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	after, limit, err := parsePage(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	games, err := GameRepo.GetGamesFromUser(r.Context(), userID, 100)
+	games, err := GameRepo.GetGamesFromUser(r.Context(), filter, after, limit)
 	if err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
 	}
 
+	var total *int
+	if r.URL.Query().Get("count") == "true" {
+		count, err := GameRepo.CountGamesFromUser(r.Context(), filter)
+		if err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+		total = &count
+	}
+
+	var last repositories.PageCursor
+	if len(games) > 0 {
+		last = repositories.PageCursor{Time: games[len(games)-1].StartedAt, ID: games[len(games)-1].ID}
+	}
+	writePageHeaders(w, len(games), limit, last, total)
+
 	jsonData, err := json.Marshal(games)
 	if err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
@@ -61,3 +93,200 @@ func routeGetGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// parseGameFilter reads the filters of the game history: user (required), opponent, color, result,
+// reason, since, until, time_control ("3+2" or a category like "blitz"), rated and opening (an ECO code
+// or its first letters, or the start of the opening name)
+func parseGameFilter(query url.Values) (repositories.GameFilter, error) {
+	var filter repositories.GameFilter
+
+	userID, err := uuid.Parse(query.Get("user"))
+	if err != nil {
+		return filter, errors.New("Bad request")
+	}
+	filter.UserID = userID
+	filter.Opponent = query.Get("opponent")
+	filter.ResultReason = query.Get("reason")
+	filter.Opening = query.Get("opening")
+
+	switch color := query.Get("color"); color {
+	case "", "white", "black":
+		filter.Color = color
+	default:
+		return filter, errors.New("invalid color")
+	}
+
+	switch result := query.Get("result"); result {
+	case "", "win", "loss", "draw", "white", "black", "aborted", "in_progress":
+		filter.Result = result
+	default:
+		return filter, errors.New("invalid result")
+	}
+
+	filter.From, filter.To, err = parseDateRange(query)
+	if err != nil {
+		return filter, err
+	}
+
+	if timeControl := query.Get("time_control"); timeControl != "" {
+		switch timeControl {
+		case "bullet", "blitz", "rapid", "classical":
+			filter.TimeCategory = timeControl
+		default:
+			base, increment, ok := strings.Cut(timeControl, "+")
+			baseMinutes, err1 := strconv.ParseInt(base, 10, 64)
+			incrementSeconds, err2 := strconv.ParseInt(increment, 10, 64)
+			if !ok || err1 != nil || err2 != nil {
+				return filter, errors.New("invalid time_control")
+			}
+			baseMs := baseMinutes * 60 * 1000
+			incrementMs := incrementSeconds * 1000
+			filter.ClockBaseMs = &baseMs
+			filter.IncrementMs = &incrementMs
+		}
+	}
+
+	if rated := query.Get("rated"); rated != "" {
+		value, err := strconv.ParseBool(rated)
+		if err != nil {
+			return filter, errors.New("invalid rated")
+		}
+		filter.Rated = &value
+	}
+
+	return filter, nil
+}
+
+func routeGetGameMoves(w http.ResponseWriter, r *http.Request) {
+	gameID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	game, err := GameRepo.GetGame(r.Context(), gameID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if game == nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	moves, err := GameRepo.GetGameMoves(r.Context(), gameID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// PGN of the game with the clock of each move embedded as [%clk] comments
+	if r.URL.Query().Get("format") == "pgn" {
+		w.Header().Set("Content-Type", "application/x-chess-pgn")
+		if err := writePGN(w, game, moves, true); err != nil {
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if moves == nil {
+		moves = make([]models.GameMove, 0)
+	}
+
+	jsonData, err := json.Marshal(moves)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write([]byte(jsonData))
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// routeGetGamePGN serves GET /game/{id}.pgn, with [%clk] comments if clocks=true
+func routeGetGamePGN(w http.ResponseWriter, r *http.Request, id string) {
+	gameID, err := uuid.Parse(id)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	game, err := GameRepo.GetGame(r.Context(), gameID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if game == nil {
+		http.Error(w, "Game not found", http.StatusNotFound)
+		return
+	}
+
+	moves, err := GameRepo.GetGameMoves(r.Context(), gameID)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-chess-pgn")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", gameID.String()+".pgn"))
+	if err := writePGN(w, game, moves, r.URL.Query().Get("clocks") == "true"); err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+	}
+}
+
+// routeGetGameExport streams the finished games of a user as PGN, most recent first. It takes the filters
+// of the game history, and reads the games a page at a time so the archive is never held in memory
+func routeGetGameExport(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseGameFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Status = "ended"
+	clocks := r.URL.Query().Get("clocks") == "true"
+
+	w.Header().Set("Content-Type", "application/x-chess-pgn")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filter.UserID.String()+".pgn"))
+	flusher, _ := w.(http.Flusher)
+
+	var after *repositories.PageCursor
+	for {
+		games, err := GameRepo.GetGamesFromUser(r.Context(), filter, after, maxPageSize)
+		if err != nil {
+			// The response may have started already, all that can be done is to cut it short
+			fmt.Println("Falha ao exportar partidas:", err)
+			return
+		}
+		if len(games) == 0 {
+			return
+		}
+
+		gameIDs := make([]uuid.UUID, len(games))
+		for i := range games {
+			gameIDs[i] = games[i].ID
+		}
+		moves, err := GameRepo.GetMovesOfGames(r.Context(), gameIDs)
+		if err != nil {
+			fmt.Println("Falha ao exportar partidas:", err)
+			return
+		}
+
+		for i := range games {
+			if err := writePGN(w, &games[i], moves[games[i].ID], clocks); err != nil {
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if len(games) < maxPageSize {
+			return
+		}
+		last := games[len(games)-1]
+		after = &repositories.PageCursor{Time: last.StartedAt, ID: last.ID}
+	}
+}
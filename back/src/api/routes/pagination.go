@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"database/repositories"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// Listas paginadas devolvem o array como antes. O cursor da proxima pagina vai no header X-Next-Cursor
+// (ausente na ultima pagina) e o total, se pedido com count=true, no header X-Total-Count
+
+func encodeCursor(cursor repositories.PageCursor) string {
+	raw := cursor.Time.UTC().Format(time.RFC3339Nano) + "|" + cursor.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(encoded string) (*repositories.PageCursor, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	timePart, idPart, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, errors.New("invalid cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, timePart)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+
+	return &repositories.PageCursor{Time: t, ID: id}, nil
+}
+
+// parsePage reads the cursor and page size of a list request
+func parsePage(query url.Values) (*repositories.PageCursor, int, error) {
+	after, err := decodeCursor(query.Get("cursor"))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	limit := defaultPageSize
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxPageSize {
+			return nil, 0, errors.New("invalid limit")
+		}
+	}
+
+	return after, limit, nil
+}
+
+// parseDateRange reads the since and until filters, each either a full timestamp (RFC 3339) or a day (2006-01-02).
+// A day given as until is included in the range
+func parseDateRange(query url.Values) (time.Time, time.Time, error) {
+	parse := func(name string) (time.Time, bool, error) {
+		value := query.Get(name)
+		if value == "" {
+			return time.Time{}, false, nil
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, false, nil
+		}
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return time.Time{}, false, errors.New("invalid " + name)
+		}
+		return t, true, nil
+	}
+
+	since, _, err := parse("since")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	until, isDay, err := parse("until")
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if isDay {
+		until = until.AddDate(0, 0, 1)
+	}
+	return since, until, nil
+}
+
+// writePageHeaders sets the cursor of the next page if the page is full, and the total if it was counted
+func writePageHeaders(w http.ResponseWriter, items int, limit int, last repositories.PageCursor, total *int) {
+	if items == limit {
+		w.Header().Set("X-Next-Cursor", encodeCursor(last))
+	}
+	if total != nil {
+		w.Header().Set("X-Total-Count", strconv.Itoa(*total))
+	}
+}
@@ -0,0 +1,225 @@
+package routes
+
+import (
+	"bufio"
+	"database/models"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"utils/openings"
+
+	"github.com/corentings/chess/v2"
+)
+
+// pgnLineLength is the longest movetext line of an exported PGN, as the PGN standard recommends
+const pgnLineLength = 80
+
+// formatClock formats a remaining time the way the [%clk] PGN command expects it (H:MM:SS)
+func formatClock(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+// pgnVariantNames are the values of the [Variant] tag for games not played from the standard position
+var pgnVariantNames = map[string]string{
+	"chess960":     "Chess960",
+	"fromposition": "From Position",
+}
+
+// pgnResults maps the result stored for a game to the PGN game termination marker
+var pgnResults = map[string]string{
+	"white": "1-0",
+	"black": "0-1",
+	"draw":  "1/2-1/2",
+}
+
+// pgnTerminations maps the reasons a game ends for to the values of the [Termination] tag,
+// any other reason of a finished game is a "normal" termination
+var pgnTerminations = map[string]string{
+	"timeout":                          "time forfeit",
+	"timeout vs insufficient material": "time forfeit",
+	"abandonment":                      "abandoned",
+}
+
+func pgnTag(w io.Writer, name string, value string) {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	fmt.Fprintf(w, "[%s \"%s\"]\n", name, value)
+}
+
+func pgnRating(rating *float64) string {
+	return strconv.Itoa(int(math.Round(*rating)))
+}
+
+// pgnTimeControl formats the clock of a game as the value of the [TimeControl] tag, base+increment in
+// seconds. The PGN standard has no field for a delay, it follows as d<seconds> like in the pool descriptors,
+// so "300+0d3" is five minutes with three seconds of delay
+func pgnTimeControl(game *models.Game) string {
+	timeControl := fmt.Sprintf("%d+%d", game.ClockBaseMs/1000, game.IncrementMs/1000)
+	if game.DelayMs > 0 {
+		timeControl += fmt.Sprintf("d%d", game.DelayMs/1000)
+	}
+	return timeControl
+}
+
+// writePGN writes the PGN of a game, with the Seven Tag Roster and what else is known about the game,
+// followed by a blank line. The movetext is made of the stored moves, with the time the mover had left
+// after each of them as a [%clk] comment if clocks is set
+func writePGN(out io.Writer, game *models.Game, moves []models.GameMove, clocks bool) error {
+	w := bufio.NewWriter(out)
+
+	result, ok := pgnResults[game.Result]
+	if !ok {
+		result = "*"
+	}
+
+	event := "Casual " + game.TimeCategory + " game"
+	if game.Rated {
+		event = "Rated " + game.TimeCategory + " game"
+	}
+	if game.BotLevel > 0 {
+		event = "Game against the computer"
+	}
+
+	pgnTag(w, "Event", event)
+	pgnTag(w, "Site", "?")
+	pgnTag(w, "Date", game.StartedAt.UTC().Format("2006.01.02"))
+	pgnTag(w, "Round", "-")
+	pgnTag(w, "White", game.WhiteUsername)
+	pgnTag(w, "Black", game.BlackUsername)
+	pgnTag(w, "Result", result)
+
+	pgnTag(w, "GameId", game.ID.String())
+	pgnTag(w, "UTCDate", game.StartedAt.UTC().Format("2006.01.02"))
+	pgnTag(w, "UTCTime", game.StartedAt.UTC().Format("15:04:05"))
+	if game.WhiteRatingBefore != nil {
+		pgnTag(w, "WhiteElo", pgnRating(game.WhiteRatingBefore))
+	}
+	if game.BlackRatingBefore != nil {
+		pgnTag(w, "BlackElo", pgnRating(game.BlackRatingBefore))
+	}
+	if game.WhiteRatingBefore != nil && game.WhiteRatingAfter != nil {
+		pgnTag(w, "WhiteRatingDiff", fmt.Sprintf("%+d", int(math.Round(*game.WhiteRatingAfter-*game.WhiteRatingBefore))))
+	}
+	if game.BlackRatingBefore != nil && game.BlackRatingAfter != nil {
+		pgnTag(w, "BlackRatingDiff", fmt.Sprintf("%+d", int(math.Round(*game.BlackRatingAfter-*game.BlackRatingBefore))))
+	}
+	if game.ClockBaseMs > 0 {
+		pgnTag(w, "TimeControl", pgnTimeControl(game))
+	} else {
+		pgnTag(w, "TimeControl", "-")
+	}
+	switch {
+	case game.Status != "ended":
+		pgnTag(w, "Termination", "unterminated")
+	case game.Result == "aborted":
+		pgnTag(w, "Termination", "abandoned")
+	case pgnTerminations[game.ResultReason] != "":
+		pgnTag(w, "Termination", pgnTerminations[game.ResultReason])
+	default:
+		pgnTag(w, "Termination", "normal")
+	}
+
+	eco, opening := game.ECO, game.Opening
+	if eco == "" && (game.Variant == "" || game.Variant == "standard") {
+		// Games stored before openings were classified
+		fens := make([]string, len(moves))
+		for i, move := range moves {
+			fens[i] = move.FEN
+		}
+		if classified := openings.Classify(fens); classified != nil {
+			eco, opening = classified.ECO, classified.Name
+		}
+	}
+	if eco != "" {
+		pgnTag(w, "ECO", eco)
+		pgnTag(w, "Opening", opening)
+	}
+
+	initialFEN := game.InitialFEN
+	if game.Variant != "" && game.Variant != "standard" {
+		pgnTag(w, "Variant", pgnVariantNames[game.Variant])
+		pgnTag(w, "SetUp", "1")
+		pgnTag(w, "FEN", initialFEN)
+	}
+	w.WriteString("\n")
+
+	unreadable := false
+	if len(moves) == 0 && game.PGN != "" {
+		var err error
+		moves, err = movesFromPGN(game.PGN)
+		if err != nil {
+			// The game keeps its tags, a broken PGN must not cut short the export it's a part of
+			fmt.Println("Falha ao ler o PGN da partida", game.ID, ":", err)
+			moves, unreadable = nil, true
+		}
+		// Games from before the move history was stored have no clocks to show
+		clocks = false
+	}
+
+	moveNumber, whiteToMove := 1, true
+	if fields := strings.Fields(initialFEN); len(fields) == 6 {
+		moveNumber, _ = strconv.Atoi(fields[5])
+		whiteToMove = fields[1] == "w"
+	}
+
+	lineLength := 0
+	writeToken := func(token string) {
+		if lineLength > 0 && lineLength+1+len(token) > pgnLineLength {
+			w.WriteString("\n")
+			lineLength = 0
+		} else if lineLength > 0 {
+			w.WriteString(" ")
+			lineLength++
+		}
+		w.WriteString(token)
+		lineLength += len(token)
+	}
+
+	for i, move := range moves {
+		clock := move.BlackTimeMs
+		if whiteToMove {
+			clock = move.WhiteTimeMs
+			writeToken(fmt.Sprintf("%d.", moveNumber))
+		} else if i == 0 {
+			writeToken(fmt.Sprintf("%d...", moveNumber))
+		}
+		writeToken(move.SAN)
+		if clocks {
+			writeToken("{[%clk " + formatClock(clock) + "]}")
+		}
+
+		if !whiteToMove {
+			moveNumber++
+		}
+		whiteToMove = !whiteToMove
+	}
+	if unreadable {
+		writeToken("{Moves unavailable}")
+	}
+	writeToken(result)
+	w.WriteString("\n\n")
+
+	return w.Flush()
+}
+
+// movesFromPGN reads the moves of a PGN, for games that have no move history stored
+func movesFromPGN(pgn string) ([]models.GameMove, error) {
+	parsed, err := chess.PGN(strings.NewReader(pgn))
+	if err != nil {
+		return nil, err
+	}
+	game := chess.NewGame(parsed)
+
+	positions := game.Positions()
+	moves := make([]models.GameMove, 0, len(game.Moves()))
+	for i, move := range game.Moves() {
+		moves = append(moves, models.GameMove{
+			Ply: i + 1,
+			SAN: chess.AlgebraicNotation{}.Encode(positions[i], move),
+		})
+	}
+	return moves, nil
+}
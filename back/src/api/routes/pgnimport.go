@@ -0,0 +1,263 @@
+package routes
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"database/repositories"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	maxImportFileSize = 10 << 20 // Bytes of an uploaded PGN file
+	maxImportGames    = 1000     // Games read from a single file, the rest are skipped
+	savedGameQuota    = 2000     // Saved games a user may have
+)
+
+// importedGame is the outcome of one game of an imported file
+type importedGame struct {
+	Index  int       `json:"index"` // Position of the game in the file, from 1
+	Line   int       `json:"line"`  // Line of the file the game starts at
+	Name   string    `json:"name,omitempty"`
+	Status string    `json:"status"` // imported, duplicate, failed or skipped
+	GameID uuid.UUID `json:"game_id,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type importReport struct {
+	Imported   int            `json:"imported"`
+	Duplicates int            `json:"duplicates"`
+	Failed     int            `json:"failed"`
+	Skipped    int            `json:"skipped"`
+	Truncated  bool           `json:"truncated,omitempty"` // The file went over maxImportFileSize, games past the cut were not read
+	Games      []importedGame `json:"games"`
+}
+
+var pgnTerminationMarkers = map[string]bool{"1-0": true, "0-1": true, "1/2-1/2": true, "*": true}
+
+// pgnChunk is the text of one game of a PGN file
+type pgnChunk struct {
+	line int
+	text string
+}
+
+// splitPGN reads a PGN file a line at a time and calls onGame with the text of each game in it.
+// A game ends at its result marker or where the tags of the next one start, braces are followed so
+// a comment can't end a game
+func splitPGN(r io.Reader, onGame func(pgnChunk)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var current strings.Builder
+	start, lineNumber := 0, 0
+	inMovetext, inComment := false, false
+
+	flush := func() {
+		text := strings.TrimSpace(current.String())
+		current.Reset()
+		inMovetext = false
+		if text != "" {
+			onGame(pgnChunk{line: start, text: text})
+		}
+	}
+
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		// Lines starting with % are escaped from PGN processing
+		if !inComment && strings.HasPrefix(trimmed, "%") {
+			continue
+		}
+
+		if !inComment && strings.HasPrefix(trimmed, "[") && inMovetext {
+			flush()
+		}
+		if current.Len() == 0 {
+			if trimmed == "" {
+				continue
+			}
+			start = lineNumber
+		}
+		if !inComment && trimmed != "" && !strings.HasPrefix(trimmed, "[") {
+			inMovetext = true
+		}
+
+		for _, c := range line {
+			if c == '{' {
+				inComment = true
+			} else if c == '}' {
+				inComment = false
+			}
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		// A result marker ends the movetext, even if the next game has no tags
+		if fields := strings.Fields(trimmed); !inComment && inMovetext && len(fields) > 0 && pgnTerminationMarkers[fields[len(fields)-1]] {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	flush()
+	return nil
+}
+
+// importedGameName builds the name of an imported game from its tags, e.g. "Carlsen vs Nepo, 2021.12.03"
+func importedGameName(game *chess.Game, index int) string {
+	white, black := game.GetTagPair("White"), game.GetTagPair("Black")
+	name := ""
+	if white != "" && white != "?" && black != "" && black != "?" {
+		name = white + " vs " + black
+	} else if event := game.GetTagPair("Event"); event != "" && event != "?" {
+		name = event
+	}
+	if date := game.GetTagPair("Date"); name != "" && date != "" && !strings.HasPrefix(date, "?") {
+		name += ", " + date
+	}
+	if name == "" {
+		name = "Imported game " + strconv.Itoa(index)
+	}
+
+	name = strings.NewReplacer("<", "", ">", "").Replace(name)
+	if runes := []rune(name); len(runes) > 50 {
+		name = string(runes[:50])
+	}
+	return name
+}
+
+// routePostSavedGameImport imports the games of a PGN file sent as the "file" field of a multipart form.
+// Games are checked and saved one by one, and the response reports what happened to each of them
+func routePostSavedGameImport(w http.ResponseWriter, r *http.Request) {
+	clientID := r.Context().Value("clientId").(uuid.UUID)
+
+	// A file declared too big is refused before reading anything. Chunked uploads don't declare their size,
+	// they're cut at the limit and the report tells which games were read before the cut
+	if r.ContentLength > maxImportFileSize {
+		http.Error(w, "File is too big", http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportFileSize)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected a multipart form", http.StatusBadRequest)
+		return
+	}
+
+	var file io.Reader
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			http.Error(w, "Missing file", http.StatusBadRequest)
+			return
+		}
+		if part.FormName() == "file" {
+			file = part
+			break
+		}
+	}
+
+	savedGames, err := SavedGamesRepo.CountGamesFromUser(r.Context(), repositories.SavedGameFilter{UserID: clientID})
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	quotaLeft := savedGameQuota - savedGames
+
+	report := importReport{Games: make([]importedGame, 0)}
+	err = splitPGN(file, func(chunk pgnChunk) {
+		result := importedGame{Index: len(report.Games) + 1, Line: chunk.line}
+		defer func() {
+			report.Games = append(report.Games, result)
+		}()
+
+		if result.Index > maxImportGames {
+			result.Status, result.Error = "skipped", "too many games in the file"
+			report.Skipped++
+			return
+		}
+
+		pgn, err := chess.PGN(strings.NewReader(chunk.text))
+		if err != nil {
+			result.Status, result.Error = "failed", err.Error()
+			report.Failed++
+			return
+		}
+		game := chess.NewGame(pgn)
+		result.Name = importedGameName(game, result.Index)
+
+		// Games imported before don't count against the quota, they're reported as duplicates even when it's full
+		hash := sha256.Sum256([]byte(chunk.text))
+		contentHash := hex.EncodeToString(hash[:])
+		existing, err := SavedGamesRepo.GetGameByHash(r.Context(), clientID, contentHash)
+		if err != nil {
+			result.Status, result.Error = "failed", "failed to save the game"
+			report.Failed++
+			return
+		}
+		if existing != nil {
+			result.GameID, result.Name = existing.ID, existing.Name
+			result.Status = "duplicate"
+			report.Duplicates++
+			return
+		}
+
+		if quotaLeft <= 0 {
+			result.Status, result.Error = "skipped", "saved game quota reached"
+			report.Skipped++
+			return
+		}
+
+		savedGame, created, err := SavedGamesRepo.ImportGame(r.Context(), clientID, result.Name, chunk.text, game.FEN(), contentHash)
+		if err != nil {
+			result.Status, result.Error = "failed", "failed to save the game"
+			report.Failed++
+			return
+		}
+
+		result.GameID = savedGame.ID
+		if created {
+			result.Status = "imported"
+			report.Imported++
+			quotaLeft--
+		} else {
+			result.Name = savedGame.Name
+			result.Status = "duplicate"
+			report.Duplicates++
+		}
+	})
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		// The game that was cut in the middle is left out, the ones before it are already saved
+		report.Truncated = true
+	} else if err != nil {
+		http.Error(w, "Failed to read the file", http.StatusBadRequest)
+		return
+	}
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(jsonData)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+	}
+}
@@ -39,3 +39,77 @@ func GameRouter(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid Method", err)
 	}
 }
+
+func GameMovesRouter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		routeGetGameMoves(w, r)
+	default:
+		err := http.StatusMethodNotAllowed
+		http.Error(w, "Invalid Method", err)
+	}
+}
+
+func GameChatRouter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		routeGetGameChat(w, r)
+	default:
+		err := http.StatusMethodNotAllowed
+		http.Error(w, "Invalid Method", err)
+	}
+}
+
+func GameModerationChatRouter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		routeGetGameModerationChat(w, r)
+	default:
+		err := http.StatusMethodNotAllowed
+		http.Error(w, "Invalid Method", err)
+	}
+}
+
+func GameAnalysisRouter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		routePostGameAnalysis(w, r)
+	case http.MethodGet:
+		routeGetGameAnalysis(w, r)
+	default:
+		err := http.StatusMethodNotAllowed
+		http.Error(w, "Invalid Method", err)
+	}
+}
+
+func SavedGameAnalysisRouter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		routePostSavedGameAnalysis(w, r)
+	case http.MethodGet:
+		routeGetSavedGameAnalysis(w, r)
+	default:
+		err := http.StatusMethodNotAllowed
+		http.Error(w, "Invalid Method", err)
+	}
+}
+
+func GameExportRouter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		routeGetGameExport(w, r)
+	default:
+		err := http.StatusMethodNotAllowed
+		http.Error(w, "Invalid Method", err)
+	}
+}
+
+func SavedGameImportRouter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		routePostSavedGameImport(w, r)
+	default:
+		err := http.StatusMethodNotAllowed
+		http.Error(w, "Invalid Method", err)
+	}
+}
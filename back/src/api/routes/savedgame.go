@@ -4,6 +4,7 @@ import (
 	"database/models"
 	"database/repositories"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -25,14 +26,42 @@ func routeGetSavedGame(w http.ResponseWriter, r *http.Request) {
 	clientID := r.Context().Value("clientId").(uuid.UUID)
 
 	if id == "" {
-		// fetch-all-games
+		// fetch-all-games, paginado e filtrado por name, since e until
 
-		savedGames, err := SavedGamesRepo.GetGamesFromUser(r.Context(), clientID, 100)
+		from, to, err := parseDateRange(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter := repositories.SavedGameFilter{UserID: clientID, Name: r.URL.Query().Get("name"), From: from, To: to}
+		after, limit, err := parsePage(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		savedGames, err := SavedGamesRepo.GetGamesFromUser(r.Context(), filter, after, limit)
 		if err != nil {
 			http.Error(w, "Failed to fetch games", http.StatusInternalServerError)
 			return
 		}
 
+		var total *int
+		if r.URL.Query().Get("count") == "true" {
+			count, err := SavedGamesRepo.CountGamesFromUser(r.Context(), filter)
+			if err != nil {
+				http.Error(w, "Failed to fetch games", http.StatusInternalServerError)
+				return
+			}
+			total = &count
+		}
+
+		var last repositories.PageCursor
+		if len(savedGames) > 0 {
+			last = repositories.PageCursor{Time: savedGames[len(savedGames)-1].CreatedAt, ID: savedGames[len(savedGames)-1].ID}
+		}
+		writePageHeaders(w, len(savedGames), limit, last, total)
+
 		jsonData, err := json.Marshal(savedGames)
 
 		if _, e := w.Write([]byte(jsonData)); e != nil {
@@ -96,9 +125,21 @@ func routePostSavedGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	savedCount, err := SavedGamesRepo.CountGamesFromUser(r.Context(), repositories.SavedGameFilter{UserID: clientID})
+	if err != nil {
+		http.Error(w, "Internal Error", http.StatusInternalServerError)
+		return
+	}
+	quotaLeft := savedGameQuota - savedCount
+
 	someOk := false
 	errorMessage := ""
 	for _, msg := range GamePGNMsgArr {
+		if quotaLeft <= 0 {
+			errorMessage = "Saved game quota reached"
+			break
+		}
+
 		if len(msg.Name) > 50 {
 			errorMessage = "Name is too big (has to be at most 50 chars wide)"
 			continue
@@ -125,6 +166,7 @@ func routePostSavedGame(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
+		quotaLeft--
 		someOk = true
 	}
 
@@ -135,7 +177,7 @@ func routePostSavedGame(w http.ResponseWriter, r *http.Request) {
 
 	// retorna todos os jogos atualizados do usuario para atualizar no frontend
 
-	savedGames, err := SavedGamesRepo.GetGamesFromUser(r.Context(), clientID, 100)
+	savedGames, err := SavedGamesRepo.GetGamesFromUser(r.Context(), repositories.SavedGameFilter{UserID: clientID}, nil, maxPageSize)
 	if err != nil {
 		http.Error(w, "Failed to fetch games", http.StatusInternalServerError)
 		return
@@ -208,7 +250,14 @@ func routePutSavedGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	savedGames, err := SavedGamesRepo.GetGamesFromUser(r.Context(), clientID, 100)
+	// a analise existente so precisa das posicoes novas do PGN editado
+	if Analyzer != nil {
+		if err := Analyzer.SavedGameChanged(r.Context(), &gameModel); err != nil {
+			fmt.Println("Falha ao atualizar a analise do jogo salvo:", err)
+		}
+	}
+
+	savedGames, err := SavedGamesRepo.GetGamesFromUser(r.Context(), repositories.SavedGameFilter{UserID: clientID}, nil, maxPageSize)
 	if err != nil {
 		http.Error(w, "Failed to delete games", http.StatusInternalServerError)
 		return
@@ -246,7 +295,7 @@ func routeDeleteSavedGame(w http.ResponseWriter, r *http.Request) {
 
 	// envia a lista completa de jogos atualizados
 
-	savedGames, err := SavedGamesRepo.GetGamesFromUser(r.Context(), clientID, 100)
+	savedGames, err := SavedGamesRepo.GetGamesFromUser(r.Context(), repositories.SavedGameFilter{UserID: clientID}, nil, maxPageSize)
 	if err != nil {
 		http.Error(w, "Failed to delete games", http.StatusInternalServerError)
 		return
@@ -30,6 +30,12 @@ func routeGetUserStats(w http.ResponseWriter, r *http.Request) {
 	user.PasswordHash = ""
 	user.Email = ""
 
+	user.Stats.Openings, err = UserRepo.GetUserOpeningStats(r.Context(), id, 50)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
 	jsonData, err := json.Marshal(user)
 	if err != nil {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type GameAnalysis struct {
+	GameID         uuid.UUID      `json:"game_id" db:"game_id"`
+	Status         string         `json:"status" db:"status"`
+	Depth          int            `json:"depth" db:"depth"`
+	Nodes          int64          `json:"nodes" db:"nodes"`
+	PositionsTotal int            `json:"positions_total" db:"positions_total"`
+	PositionsDone  int            `json:"positions_done" db:"positions_done"`
+	WhiteAccuracy  *float64       `json:"white_accuracy,omitempty" db:"white_accuracy"`
+	BlackAccuracy  *float64       `json:"black_accuracy,omitempty" db:"black_accuracy"`
+	Error          string         `json:"error,omitempty" db:"error"`
+	RequestedBy    uuid.UUID      `json:"requested_by" db:"requested_by"`
+	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at" db:"updated_at"`
+	Moves          []MoveAnalysis `json:"moves" db:"-"`
+}
+
+// MoveAnalysis is the evaluation of the position after a move, and how good that move was.
+// Evaluations are from white's point of view
+type MoveAnalysis struct {
+	GameID         uuid.UUID `json:"-" db:"game_id"`
+	Ply            int       `json:"ply" db:"ply"`
+	SAN            string    `json:"san" db:"san"`
+	UCI            string    `json:"uci" db:"uci"`
+	EvalCp         *int      `json:"eval_cp,omitempty" db:"eval_cp"`
+	EvalMate       *int      `json:"eval_mate,omitempty" db:"eval_mate"`
+	BestMove       string    `json:"best_move" db:"best_move"` // What the engine would play from this position
+	Classification string    `json:"classification,omitempty" db:"classification"`
+	Accuracy       *float64  `json:"accuracy,omitempty" db:"accuracy"`
+}
+
+// SavedGameAnalysis is the engine analysis of a saved game. It covers every position of the PGN tree,
+// variations included, and is kept up to date as the PGN is edited
+type SavedGameAnalysis struct {
+	SavedGameID    uuid.UUID           `json:"saved_game_id" db:"saved_game_id"`
+	Status         string              `json:"status" db:"status"`
+	Depth          int                 `json:"depth" db:"depth"`
+	Nodes          int64               `json:"nodes" db:"nodes"`
+	PositionsTotal int                 `json:"positions_total" db:"positions_total"`
+	PositionsDone  int                 `json:"positions_done" db:"positions_done"`
+	Error          string              `json:"error,omitempty" db:"error"`
+	CreatedAt      time.Time           `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at" db:"updated_at"`
+	Positions      []SavedGamePosition `json:"-" db:"-"`
+}
+
+// SavedGamePosition is the evaluation of one position of a saved game, from white's point of view.
+// FEN leaves out the move counters, so transpositions inside the tree are analysed once
+type SavedGamePosition struct {
+	SavedGameID uuid.UUID `json:"-" db:"saved_game_id"`
+	FEN         string    `json:"fen" db:"fen"`
+	EvalCp      *int      `json:"eval_cp,omitempty" db:"eval_cp"`
+	EvalMate    *int      `json:"eval_mate,omitempty" db:"eval_mate"`
+	BestMove    string    `json:"best_move" db:"best_move"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Challenge struct {
+	ID           uuid.UUID  `json:"challenge_id" db:"challenge_id"`
+	ChallengerID uuid.UUID  `json:"challenger_id" db:"challenger_id"`
+	TargetID     *uuid.UUID `json:"target_id,omitempty" db:"target_id"`
+	Color        string     `json:"color" db:"color"`
+	Pool         string     `json:"pool" db:"pool"`
+	InitialFEN   string     `json:"initial_fen" db:"initial_fen"`
+	Status       string     `json:"status" db:"status"`
+	GameID       *uuid.UUID `json:"game_id,omitempty" db:"game_id"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt    time.Time  `json:"expires_at" db:"expires_at"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChatMessage is a message sent in the chat of a game, in the channel of the players or in the one of the spectators
+type ChatMessage struct {
+	ID       int64     `json:"id" db:"message_id"`
+	GameID   uuid.UUID `json:"game_id" db:"game_id"`
+	UserID   uuid.UUID `json:"user_id" db:"user_id"`
+	Username string    `json:"username" db:"username"`
+	Channel  string    `json:"channel" db:"channel"`
+	Text     string    `json:"text" db:"text"`
+	SentAt   time.Time `json:"sent_at" db:"sent_at"`
+}
@@ -7,16 +7,32 @@ import (
 )
 
 type Game struct {
-	ID            uuid.UUID `json:"game_id" db:"game_id"`
-	WhiteID       uuid.UUID `json:"white_id" db:"white_id"`
-	BlackID       uuid.UUID `json:"black_id" db:"black_id"`
-	PGN           string    `json:"pgn,omitempty" db:"pgn"`
-	Status        string    `json:"status" db:"status"`
-	Result        string    `json:"result,omitempty" db:"result"`
-	ResultReason  string    `json:"result_reason,omitempty" db:"result_reason"`
-	LastFEN       string    `json:"last_fen,omitempty" db:"last_fen"`
-	StartedAt     time.Time `json:"started_at,omitempty" db:"started_at"`
-	EndedAt       time.Time `json:"ended_at,omitempty" db:"ended_at"`
-	WhiteUsername string    `json:"white_username" db:"-"`
-	BlackUsername string    `json:"black_username" db:"-"`
+	ID                uuid.UUID `json:"game_id" db:"game_id"`
+	WhiteID           uuid.UUID `json:"white_id" db:"white_id"`
+	BlackID           uuid.UUID `json:"black_id" db:"black_id"`
+	PGN               string    `json:"pgn,omitempty" db:"pgn"`
+	Status            string    `json:"status" db:"status"`
+	Result            string    `json:"result,omitempty" db:"result"`
+	ResultReason      string    `json:"result_reason,omitempty" db:"result_reason"`
+	LastFEN           string    `json:"last_fen,omitempty" db:"last_fen"`
+	StartedAt         time.Time `json:"started_at,omitempty" db:"started_at"`
+	EndedAt           time.Time `json:"ended_at,omitempty" db:"ended_at"`
+	Rated             bool      `json:"rated" db:"rated"`
+	ClockBaseMs       int64     `json:"clock_base_ms" db:"clock_base_ms"`
+	IncrementMs       int64     `json:"clock_increment_ms" db:"clock_increment_ms"`
+	DelayMs           int64     `json:"clock_delay_ms" db:"clock_delay_ms"`
+	WhiteTimeMs       int64     `json:"white_time_ms" db:"white_time_ms"`
+	BlackTimeMs       int64     `json:"black_time_ms" db:"black_time_ms"`
+	TimeCategory      string    `json:"time_category" db:"time_category"`
+	WhiteRatingBefore *float64  `json:"white_rating_before,omitempty" db:"white_rating_before"`
+	WhiteRatingAfter  *float64  `json:"white_rating_after,omitempty" db:"white_rating_after"`
+	BlackRatingBefore *float64  `json:"black_rating_before,omitempty" db:"black_rating_before"`
+	BlackRatingAfter  *float64  `json:"black_rating_after,omitempty" db:"black_rating_after"`
+	Variant           string    `json:"variant" db:"variant"`
+	InitialFEN        string    `json:"initial_fen" db:"initial_fen"`
+	BotLevel          int       `json:"bot_level,omitempty" db:"bot_level"`
+	ECO               string    `json:"eco,omitempty" db:"eco"`
+	Opening           string    `json:"opening,omitempty" db:"opening"`
+	WhiteUsername     string    `json:"white_username" db:"-"`
+	BlackUsername     string    `json:"black_username" db:"-"`
 }
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type GameMove struct {
+	GameID      uuid.UUID `json:"game_id" db:"game_id"`
+	Ply         int       `json:"ply" db:"ply"`
+	SAN         string    `json:"san" db:"san"`
+	UCI         string    `json:"uci" db:"uci"`
+	FEN         string    `json:"fen" db:"fen"`
+	PlayedAt    time.Time `json:"played_at" db:"played_at"`
+	WhiteTimeMs int64     `json:"white_time_ms" db:"white_time_ms"`
+	BlackTimeMs int64     `json:"black_time_ms" db:"black_time_ms"`
+}
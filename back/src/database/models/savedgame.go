@@ -13,4 +13,6 @@ type SavedGame struct {
 	PGN       string    `json:"pgn" db:"pgn"`
 	LastFEN   string    `json:"last_fen" db:"last_fen"`
 	CreatedAt time.Time `db:"created_at"`
+	// Set on imported games only, see SavedGameRepo.ImportGame
+	ContentHash *string `json:"-" db:"content_hash"`
 }
@@ -16,10 +16,34 @@ type User struct {
 }
 
 type UserStats struct {
+	ID          uuid.UUID      `db:"user_id" json:"-"`
+	Wins        int            `db:"wins" json:"wins"`
+	Draws       int            `db:"draws" json:"draws"`
+	Losses      int            `db:"losses" json:"losses"`
+	GamesPlayed int            `db:"games_played" json:"games_played"`
+	LastUpdated time.Time      `db:"last_updated" json:"last_updated,omitempty"`
+	Ratings     []UserRating   `db:"-" json:"ratings"`
+	Openings    []OpeningStats `db:"-" json:"openings,omitempty"`
+}
+
+type UserRating struct {
 	ID          uuid.UUID `db:"user_id" json:"-"`
-	Wins        int       `db:"wins" json:"wins"`
-	Draws       int       `db:"draws" json:"draws"`
-	Losses      int       `db:"losses" json:"losses"`
+	Category    string    `db:"category" json:"category"`
+	Rating      float64   `db:"rating" json:"rating"`
+	Deviation   float64   `db:"deviation" json:"deviation"`
+	Volatility  float64   `db:"volatility" json:"volatility"`
 	GamesPlayed int       `db:"games_played" json:"games_played"`
-	LastUpdated time.Time `db:"last_updated" json:"last_updated,omitempty"`
+	LastUpdated time.Time `db:"last_updated" json:"last_updated"`
+}
+
+// OpeningStats are the results of a user in an opening, with one color
+type OpeningStats struct {
+	ECO     string  `db:"eco" json:"eco"`
+	Name    string  `db:"opening" json:"name"`
+	Color   string  `db:"color" json:"color"`
+	Games   int     `db:"games" json:"games"`
+	Wins    int     `db:"wins" json:"wins"`
+	Draws   int     `db:"draws" json:"draws"`
+	Losses  int     `db:"losses" json:"losses"`
+	WinRate float64 `db:"-" json:"win_rate"`
 }
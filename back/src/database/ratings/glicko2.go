@@ -0,0 +1,131 @@
+package ratings
+
+import "math"
+
+const (
+	DefaultRating     = 1500.0
+	DefaultDeviation  = 350.0
+	DefaultVolatility = 0.06
+
+	// System constant, constrains how much the volatility can change between games
+	tau = 0.5
+	// Converts between the Glicko and the Glicko-2 scales
+	glicko2Scale = 173.7178
+	// Convergence tolerance of the volatility iteration
+	epsilon = 0.000001
+)
+
+type Rating struct {
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+}
+
+func NewRating() Rating {
+	return Rating{
+		Rating:     DefaultRating,
+		Deviation:  DefaultDeviation,
+		Volatility: DefaultVolatility,
+	}
+}
+
+// Result is a game of a rating period, score is 1 for a win, 0.5 for a draw and 0 for a loss
+type Result struct {
+	Opponent Rating
+	Score    float64
+}
+
+// Update returns the rating of player after a single game (rating period) against opponent.
+// score is 1 for a win, 0.5 for a draw and 0 for a loss
+func Update(player Rating, opponent Rating, score float64) Rating {
+	return UpdatePeriod(player, []Result{{Opponent: opponent, Score: score}})
+}
+
+// UpdatePeriod returns the rating of player after the games of a rating period
+func UpdatePeriod(player Rating, results []Result) Rating {
+	mu := (player.Rating - DefaultRating) / glicko2Scale
+	phi := player.Deviation / glicko2Scale
+	sigma := player.Volatility
+
+	if len(results) == 0 {
+		phiStar := math.Sqrt(phi*phi + sigma*sigma)
+		return Rating{
+			Rating:     player.Rating,
+			Deviation:  min(phiStar*glicko2Scale, DefaultDeviation),
+			Volatility: sigma,
+		}
+	}
+
+	var vInv, improvement float64
+	for _, result := range results {
+		opponentMu := (result.Opponent.Rating - DefaultRating) / glicko2Scale
+		opponentPhi := result.Opponent.Deviation / glicko2Scale
+
+		g := 1 / math.Sqrt(1+3*opponentPhi*opponentPhi/(math.Pi*math.Pi))
+		expected := 1 / (1 + math.Exp(-g*(mu-opponentMu)))
+		vInv += g * g * expected * (1 - expected)
+		improvement += g * (result.Score - expected)
+	}
+	v := 1 / vInv
+	delta := v * improvement
+
+	// New volatility, found with the Illinois algorithm
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA := f(A)
+	fB := f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A = B
+			fA = fB
+		} else {
+			fA /= 2
+		}
+		B = C
+		fB = fC
+	}
+	newSigma := math.Exp(A / 2)
+
+	phiStar := math.Sqrt(phi*phi + newSigma*newSigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*improvement
+
+	return Rating{
+		Rating:     newMu*glicko2Scale + DefaultRating,
+		Deviation:  min(newPhi*glicko2Scale, DefaultDeviation),
+		Volatility: newSigma,
+	}
+}
+
+// TimeCategory classifies a time control by its estimated duration (base time + 40 moves worth of increment/delay)
+func TimeCategory(baseMs int64, incrementMs int64, delayMs int64) string {
+	estimatedMs := baseMs + 40*(incrementMs+delayMs)
+	switch {
+	case estimatedMs < 3*60*1000:
+		return "bullet"
+	case estimatedMs < 8*60*1000:
+		return "blitz"
+	case estimatedMs < 25*60*1000:
+		return "rapid"
+	}
+	return "classical"
+}
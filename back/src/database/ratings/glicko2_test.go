@@ -0,0 +1,89 @@
+package ratings
+
+import (
+	"math"
+	"testing"
+)
+
+// The worked example of Glickman's "Example of the Glicko-2 system"
+func TestUpdatePeriodGlickmanExample(t *testing.T) {
+	player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+	results := []Result{
+		{Opponent: Rating{Rating: 1400, Deviation: 30, Volatility: DefaultVolatility}, Score: 1},
+		{Opponent: Rating{Rating: 1550, Deviation: 100, Volatility: DefaultVolatility}, Score: 0},
+		{Opponent: Rating{Rating: 1700, Deviation: 300, Volatility: DefaultVolatility}, Score: 0},
+	}
+
+	got := UpdatePeriod(player, results)
+
+	if math.Abs(got.Rating-1464.06) > 0.01 {
+		t.Errorf("rating = %.4f, want 1464.06", got.Rating)
+	}
+	if math.Abs(got.Deviation-151.52) > 0.01 {
+		t.Errorf("deviation = %.4f, want 151.52", got.Deviation)
+	}
+	if math.Abs(got.Volatility-0.05999) > 0.00001 {
+		t.Errorf("volatility = %.6f, want 0.05999", got.Volatility)
+	}
+}
+
+func TestUpdateSingleGame(t *testing.T) {
+	player := NewRating()
+	opponent := NewRating()
+
+	tests := []struct {
+		name  string
+		score float64
+		check func(Rating) bool
+	}{
+		{"win", 1, func(r Rating) bool { return r.Rating > DefaultRating }},
+		{"draw", 0.5, func(r Rating) bool { return math.Abs(r.Rating-DefaultRating) < 1e-9 }},
+		{"loss", 0, func(r Rating) bool { return r.Rating < DefaultRating }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Update(player, opponent, tt.score)
+			if !tt.check(got) {
+				t.Errorf("Update() rating = %.4f", got.Rating)
+			}
+			if got.Deviation >= DefaultDeviation {
+				t.Errorf("Update() deviation = %.4f, want less than %v", got.Deviation, DefaultDeviation)
+			}
+			want := UpdatePeriod(player, []Result{{Opponent: opponent, Score: tt.score}})
+			if got != want {
+				t.Errorf("Update() = %+v, UpdatePeriod() = %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestTimeCategory(t *testing.T) {
+	const minute = 60 * 1000
+
+	tests := []struct {
+		name        string
+		baseMs      int64
+		incrementMs int64
+		delayMs     int64
+		want        string
+	}{
+		{"bullet", 1 * minute, 0, 0, "bullet"},
+		{"just under blitz", 3*minute - 1, 0, 0, "bullet"},
+		{"blitz boundary", 3 * minute, 0, 0, "blitz"},
+		{"blitz from increment", 2 * minute, 2000, 0, "blitz"},
+		{"just under rapid", 8*minute - 1, 0, 0, "blitz"},
+		{"rapid boundary", 8 * minute, 0, 0, "rapid"},
+		{"rapid from increment", 5 * minute, 5000, 0, "rapid"},
+		{"rapid from delay", 5 * minute, 0, 5000, "rapid"},
+		{"just under classical", 25*minute - 1, 0, 0, "rapid"},
+		{"classical boundary", 25 * minute, 0, 0, "classical"},
+		{"classical with increment", 15 * minute, 15000, 0, "classical"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TimeCategory(tt.baseMs, tt.incrementMs, tt.delayMs); got != tt.want {
+				t.Errorf("TimeCategory(%d, %d, %d) = %q, want %q", tt.baseMs, tt.incrementMs, tt.delayMs, got, tt.want)
+			}
+		})
+	}
+}
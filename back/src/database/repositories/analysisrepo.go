@@ -0,0 +1,247 @@
+package repositories
+
+import (
+	"context"
+	"database/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AnalysisRepo struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewAnalysisRepo(dbPool *pgxpool.Pool) *AnalysisRepo {
+	return &AnalysisRepo{
+		dbPool: dbPool,
+	}
+}
+
+// CreateGameAnalysis queues the analysis of a game. An analysis that failed is queued again, created is
+// false if the game already had one queued, running or done, which is returned instead
+func (repo *AnalysisRepo) CreateGameAnalysis(ctx context.Context, gameID uuid.UUID, requestedBy uuid.UUID, depth int, nodes int64, positions int) (*models.GameAnalysis, bool, error) {
+	query := `INSERT INTO chess.game_analysis(game_id, requested_by, depth, nodes, positions_total) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (game_id) DO UPDATE SET
+		status = 'queued', requested_by = $2, depth = $3, nodes = $4, positions_total = $5, positions_done = 0,
+		white_accuracy = NULL, black_accuracy = NULL, error = '', created_at = NOW(), updated_at = NOW()
+	WHERE chess.game_analysis.status = 'failed'
+	RETURNING *;`
+
+	rows, err := repo.dbPool.Query(ctx, query, gameID, requestedBy, depth, nodes, positions)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	analysis, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.GameAnalysis])
+	if err == pgx.ErrNoRows {
+		existing, err := repo.GetGameAnalysis(ctx, gameID)
+		return existing, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &analysis, true, nil
+}
+
+// GetGameAnalysis returns the analysis of a game with the positions analysed so far, or nil if there is none
+func (repo *AnalysisRepo) GetGameAnalysis(ctx context.Context, gameID uuid.UUID) (*models.GameAnalysis, error) {
+	rows, err := repo.dbPool.Query(ctx, `SELECT * FROM chess.game_analysis WHERE game_id=$1;`, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	analysis, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.GameAnalysis])
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = repo.dbPool.Query(ctx, `SELECT * FROM chess.game_analysis_move WHERE game_id=$1 ORDER BY ply ASC;`, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	analysis.Moves, err = pgx.CollectRows(rows, pgx.RowToStructByName[models.MoveAnalysis])
+	if err != nil {
+		return nil, err
+	}
+
+	return &analysis, nil
+}
+
+// GetUnfinishedGameAnalyses returns the games whose analysis is queued or was interrupted while running
+func (repo *AnalysisRepo) GetUnfinishedGameAnalyses(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := repo.dbPool.Query(ctx, `SELECT game_id FROM chess.game_analysis WHERE status IN ('queued', 'running') ORDER BY created_at ASC;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+}
+
+// StartGameAnalysis marks the analysis as running and forgets positions analysed by an interrupted run
+func (repo *AnalysisRepo) StartGameAnalysis(ctx context.Context, gameID uuid.UUID) error {
+	tx, err := repo.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `DELETE FROM chess.game_analysis_move WHERE game_id=$1;`, gameID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `UPDATE chess.game_analysis SET status='running', positions_done=0, updated_at=NOW() WHERE game_id=$1;`, gameID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// AddMoveAnalysis stores the analysis of one more position and counts it in the progress of the game analysis
+func (repo *AnalysisRepo) AddMoveAnalysis(ctx context.Context, move *models.MoveAnalysis) error {
+	query := `WITH inserted AS (
+		INSERT INTO chess.game_analysis_move(game_id, ply, san, uci, eval_cp, eval_mate, best_move, classification, accuracy)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	)
+	UPDATE chess.game_analysis SET positions_done = positions_done + 1, updated_at = NOW() WHERE game_id = $1;`
+
+	_, err := repo.dbPool.Exec(ctx, query, move.GameID, move.Ply, move.SAN, move.UCI, move.EvalCp, move.EvalMate,
+		move.BestMove, move.Classification, move.Accuracy)
+	return err
+}
+
+func (repo *AnalysisRepo) FinishGameAnalysis(ctx context.Context, gameID uuid.UUID, whiteAccuracy *float64, blackAccuracy *float64) error {
+	query := `UPDATE chess.game_analysis SET status='done', white_accuracy=$2, black_accuracy=$3, updated_at=NOW() WHERE game_id=$1;`
+	_, err := repo.dbPool.Exec(ctx, query, gameID, whiteAccuracy, blackAccuracy)
+	return err
+}
+
+func (repo *AnalysisRepo) FailGameAnalysis(ctx context.Context, gameID uuid.UUID, reason string) error {
+	query := `UPDATE chess.game_analysis SET status='failed', error=$2, updated_at=NOW() WHERE game_id=$1;`
+	_, err := repo.dbPool.Exec(ctx, query, gameID, reason)
+	return err
+}
+
+// QueueSavedGameAnalysis creates the analysis of a saved game, or queues again one that is done or failed.
+// Positions analysed before are kept, the next run only analyses the ones that are missing
+func (repo *AnalysisRepo) QueueSavedGameAnalysis(ctx context.Context, savedGameID uuid.UUID, depth int, nodes int64) (*models.SavedGameAnalysis, error) {
+	query := `INSERT INTO chess.saved_game_analysis(saved_game_id, depth, nodes) VALUES ($1, $2, $3)
+	ON CONFLICT (saved_game_id) DO UPDATE SET status = 'queued', depth = $2, nodes = $3, error = '', updated_at = NOW()
+	WHERE chess.saved_game_analysis.status IN ('done', 'failed');`
+
+	_, err := repo.dbPool.Exec(ctx, query, savedGameID, depth, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.GetSavedGameAnalysis(ctx, savedGameID)
+}
+
+// GetSavedGameAnalysis returns the analysis of a saved game with the positions analysed so far, or nil if there is none
+func (repo *AnalysisRepo) GetSavedGameAnalysis(ctx context.Context, savedGameID uuid.UUID) (*models.SavedGameAnalysis, error) {
+	rows, err := repo.dbPool.Query(ctx, `SELECT * FROM chess.saved_game_analysis WHERE saved_game_id=$1;`, savedGameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	analysis, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.SavedGameAnalysis])
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = repo.dbPool.Query(ctx, `SELECT * FROM chess.saved_game_position WHERE saved_game_id=$1;`, savedGameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	analysis.Positions, err = pgx.CollectRows(rows, pgx.RowToStructByName[models.SavedGamePosition])
+	if err != nil {
+		return nil, err
+	}
+
+	return &analysis, nil
+}
+
+// GetUnfinishedSavedGameAnalyses returns the saved games whose analysis is queued or was interrupted while running
+func (repo *AnalysisRepo) GetUnfinishedSavedGameAnalyses(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := repo.dbPool.Query(ctx, `SELECT saved_game_id FROM chess.saved_game_analysis WHERE status IN ('queued', 'running') ORDER BY updated_at ASC;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+}
+
+// StartSavedGameAnalysis marks the analysis as running over the given positions. Positions no longer in the PGN
+// are deleted, and the FENs of the ones already analysed are returned
+func (repo *AnalysisRepo) StartSavedGameAnalysis(ctx context.Context, savedGameID uuid.UUID, fens []string) ([]string, error) {
+	tx, err := repo.dbPool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `DELETE FROM chess.saved_game_position WHERE saved_game_id=$1 AND fen <> ALL($2);`, savedGameID, fens)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `SELECT fen FROM chess.saved_game_position WHERE saved_game_id=$1;`, savedGameID)
+	if err != nil {
+		return nil, err
+	}
+	analysed, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE chess.saved_game_analysis SET status='running', positions_total=$2, positions_done=$3, updated_at=NOW() WHERE saved_game_id=$1;`
+	_, err = tx.Exec(ctx, query, savedGameID, len(fens), len(analysed))
+	if err != nil {
+		return nil, err
+	}
+
+	return analysed, tx.Commit(ctx)
+}
+
+// AddSavedGamePosition stores the analysis of one more position and counts it in the progress of the saved game analysis
+func (repo *AnalysisRepo) AddSavedGamePosition(ctx context.Context, position *models.SavedGamePosition) error {
+	query := `WITH inserted AS (
+		INSERT INTO chess.saved_game_position(saved_game_id, fen, eval_cp, eval_mate, best_move)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (saved_game_id, fen) DO NOTHING
+	)
+	UPDATE chess.saved_game_analysis SET positions_done = positions_done + 1, updated_at = NOW() WHERE saved_game_id = $1;`
+
+	_, err := repo.dbPool.Exec(ctx, query, position.SavedGameID, position.FEN, position.EvalCp, position.EvalMate, position.BestMove)
+	return err
+}
+
+func (repo *AnalysisRepo) FinishSavedGameAnalysis(ctx context.Context, savedGameID uuid.UUID) error {
+	query := `UPDATE chess.saved_game_analysis SET status='done', updated_at=NOW() WHERE saved_game_id=$1;`
+	_, err := repo.dbPool.Exec(ctx, query, savedGameID)
+	return err
+}
+
+func (repo *AnalysisRepo) FailSavedGameAnalysis(ctx context.Context, savedGameID uuid.UUID, reason string) error {
+	query := `UPDATE chess.saved_game_analysis SET status='failed', error=$2, updated_at=NOW() WHERE saved_game_id=$1;`
+	_, err := repo.dbPool.Exec(ctx, query, savedGameID, reason)
+	return err
+}
@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"database/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ChallengeRepo struct {
+	dbPool *pgxpool.Pool
+}
+
+func NewChallengeRepo(dbPool *pgxpool.Pool) *ChallengeRepo {
+	return &ChallengeRepo{
+		dbPool: dbPool,
+	}
+}
+
+// CreateChallenge stores a new pending challenge, targetID is nil for open challenge links
+// and initialFEN is empty unless the game starts from a custom position
+func (repo *ChallengeRepo) CreateChallenge(ctx context.Context, challengerID uuid.UUID, targetID *uuid.UUID, color string, pool string, initialFEN string, expiresAt time.Time) (*models.Challenge, error) {
+	query := `INSERT INTO chess.challenge(challenger_id, target_id, color, pool, initial_fen, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING *;`
+
+	rows, err := repo.dbPool.Query(ctx, query, challengerID, targetID, color, pool, initialFEN, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	challenge, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Challenge])
+	if err != nil {
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+func (repo *ChallengeRepo) GetChallenge(ctx context.Context, challengeID uuid.UUID) (*models.Challenge, error) {
+	query := `SELECT * FROM chess.challenge WHERE challenge_id=$1;`
+
+	rows, err := repo.dbPool.Query(ctx, query, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	challenge, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Challenge])
+	if err != nil {
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+// GetPendingChallenges returns the challenges sent by or to the user that are still waiting for an answer
+func (repo *ChallengeRepo) GetPendingChallenges(ctx context.Context, userID uuid.UUID) ([]models.Challenge, error) {
+	query := `SELECT * FROM chess.challenge WHERE (challenger_id=$1 OR target_id=$1) AND status='pending' AND expires_at > NOW() ORDER BY created_at DESC;`
+
+	rows, err := repo.dbPool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	challenges, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.Challenge])
+	if err != nil {
+		return nil, err
+	}
+
+	return challenges, nil
+}
+
+// CloseChallenge moves a pending, not expired challenge to the given status.
+// It returns false if the challenge was already answered or expired, so only one accept/decline/cancel wins
+func (repo *ChallengeRepo) CloseChallenge(ctx context.Context, challengeID uuid.UUID, status string) (bool, error) {
+	query := `UPDATE chess.challenge SET status=$2 WHERE challenge_id=$1 AND status='pending' AND expires_at > NOW();`
+
+	cmdTag, err := repo.dbPool.Exec(ctx, query, challengeID, status)
+	if err != nil {
+		return false, err
+	}
+
+	return (cmdTag.RowsAffected() > 0), nil
+}
+
+func (repo *ChallengeRepo) SetChallengeGame(ctx context.Context, challengeID uuid.UUID, gameID uuid.UUID) error {
+	query := `UPDATE chess.challenge SET game_id=$2 WHERE challenge_id=$1;`
+
+	_, err := repo.dbPool.Exec(ctx, query, challengeID, gameID)
+	return err
+}
+
+// ReopenChallenge puts back an accepted challenge whose room couldn't be created
+func (repo *ChallengeRepo) ReopenChallenge(ctx context.Context, challengeID uuid.UUID) error {
+	query := `UPDATE chess.challenge SET status='pending' WHERE challenge_id=$1 AND status='accepted' AND game_id IS NULL;`
+
+	_, err := repo.dbPool.Exec(ctx, query, challengeID)
+	return err
+}
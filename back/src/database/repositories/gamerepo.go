@@ -3,6 +3,8 @@ package repositories
 import (
 	"context"
 	"database/models"
+	"database/ratings"
+	"regexp"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,19 +22,19 @@ func NewGameRepo(dbPool *pgxpool.Pool) *GameRepo {
 	}
 }
 
-func (repo *GameRepo) GetGame(ctx context.Context, gameID uuid.UUID) (*models.Game, error) {
-	query := `SELECT 
-        g.*,
+// gameColumnsWithUsernames selects the columns of a game g, in the order scanGameWithUsernames reads them,
+// followed by the usernames of its players. The queries join chess.user as u_white and u_black
+const gameColumnsWithUsernames = `g.game_id, g.white_id, g.black_id, g.pgn, g.status, g.result, g.result_reason, g.last_fen,
+        g.started_at, g.ended_at, g.rated, g.clock_base_ms, g.clock_increment_ms, g.clock_delay_ms,
+        g.white_time_ms, g.black_time_ms, g.time_category,
+        g.white_rating_before, g.white_rating_after, g.black_rating_before, g.black_rating_after,
+        g.variant, g.initial_fen, g.bot_level, g.eco, g.opening,
         u_white.username AS white_username,
-        u_black.username AS black_username
-    FROM chess.game g
-    JOIN chess.user u_white ON g.white_id = u_white.user_id
-    JOIN chess.user u_black ON g.black_id = u_black.user_id
-    WHERE g.game_id = $1;`
+        u_black.username AS black_username`
 
-	var game models.Game
-
-	err := repo.dbPool.QueryRow(ctx, query, gameID).Scan(
+// scanGameWithUsernames scans a row made of gameColumnsWithUsernames
+func scanGameWithUsernames(row pgx.Row, game *models.Game) error {
+	return row.Scan(
 		&game.ID,
 		&game.WhiteID,
 		&game.BlackID,
@@ -43,9 +45,38 @@ func (repo *GameRepo) GetGame(ctx context.Context, gameID uuid.UUID) (*models.Ga
 		&game.LastFEN,
 		&game.StartedAt,
 		&game.EndedAt,
+		&game.Rated,
+		&game.ClockBaseMs,
+		&game.IncrementMs,
+		&game.DelayMs,
+		&game.WhiteTimeMs,
+		&game.BlackTimeMs,
+		&game.TimeCategory,
+		&game.WhiteRatingBefore,
+		&game.WhiteRatingAfter,
+		&game.BlackRatingBefore,
+		&game.BlackRatingAfter,
+		&game.Variant,
+		&game.InitialFEN,
+		&game.BotLevel,
+		&game.ECO,
+		&game.Opening,
 		&game.WhiteUsername,
 		&game.BlackUsername,
 	)
+}
+
+func (repo *GameRepo) GetGame(ctx context.Context, gameID uuid.UUID) (*models.Game, error) {
+	query := `SELECT
+        ` + gameColumnsWithUsernames + `
+    FROM chess.game g
+    JOIN chess.user u_white ON g.white_id = u_white.user_id
+    JOIN chess.user u_black ON g.black_id = u_black.user_id
+    WHERE g.game_id = $1;`
+
+	var game models.Game
+
+	err := scanGameWithUsernames(repo.dbPool.QueryRow(ctx, query, gameID), &game)
 
 	if err == pgx.ErrNoRows {
 		return nil, nil
@@ -57,20 +88,103 @@ func (repo *GameRepo) GetGame(ctx context.Context, gameID uuid.UUID) (*models.Ga
 	return &game, nil
 }
 
-func (repo *GameRepo) GetGamesFromUser(ctx context.Context, userID uuid.UUID, limit int) ([]models.Game, error) {
+var ecoPrefix = regexp.MustCompile(`^[A-E][0-9]{0,2}$`)
+
+// GameFilter narrows down the games of a user, fields left at their zero value don't filter
+type GameFilter struct {
+	UserID       uuid.UUID
+	Opponent     string // Username of the other player
+	Color        string // Color the user played, "white" or "black"
+	Result       string // "win", "loss" or "draw" from the user's point of view, or a result as stored ("aborted", "in_progress")
+	ResultReason string
+	From         time.Time // Games started at or after From
+	To           time.Time // Games started before To
+	TimeCategory string    // bullet, blitz, rapid or classical
+	ClockBaseMs  *int64
+	IncrementMs  *int64
+	Rated        *bool
+	Status       string // "ended" or "in_progress"
+	Opening      string // ECO code or its first letters ("B", "B2", "B20"), or the start of the opening name
+}
+
+// conditions builds the WHERE conditions of the filter. The user is always the first argument
+func (filter *GameFilter) conditions() *queryConditions {
+	q := &queryConditions{}
+	user := q.arg(filter.UserID)
+
+	switch filter.Color {
+	case "white":
+		q.conditions = append(q.conditions, "g.white_id = "+user)
+	case "black":
+		q.conditions = append(q.conditions, "g.black_id = "+user)
+	default:
+		q.conditions = append(q.conditions, "(g.white_id = "+user+" OR g.black_id = "+user+")")
+	}
+
+	if filter.Opponent != "" {
+		q.add("(CASE WHEN g.white_id = "+user+" THEN u_black.username ELSE u_white.username END) = %s::citext", filter.Opponent)
+	}
+
+	switch filter.Result {
+	case "":
+	case "win":
+		q.conditions = append(q.conditions, "((g.result = 'white' AND g.white_id = "+user+") OR (g.result = 'black' AND g.black_id = "+user+"))")
+	case "loss":
+		q.conditions = append(q.conditions, "((g.result = 'black' AND g.white_id = "+user+") OR (g.result = 'white' AND g.black_id = "+user+"))")
+	default:
+		q.add("g.result = %s", filter.Result)
+	}
+
+	if filter.ResultReason != "" {
+		q.add("g.result_reason = %s", filter.ResultReason)
+	}
+	if !filter.From.IsZero() {
+		q.add("g.started_at >= %s", filter.From)
+	}
+	if !filter.To.IsZero() {
+		q.add("g.started_at < %s", filter.To)
+	}
+	if filter.TimeCategory != "" {
+		q.add("g.time_category = %s", filter.TimeCategory)
+	}
+	if filter.ClockBaseMs != nil {
+		q.add("g.clock_base_ms = %s", *filter.ClockBaseMs)
+	}
+	if filter.IncrementMs != nil {
+		q.add("g.clock_increment_ms = %s", *filter.IncrementMs)
+	}
+	if filter.Rated != nil {
+		q.add("g.rated = %s", *filter.Rated)
+	}
+	if filter.Status != "" {
+		q.add("g.status = %s", filter.Status)
+	}
+	if ecoPrefix.MatchString(filter.Opening) {
+		q.add("g.eco LIKE %s", filter.Opening+"%")
+	} else if filter.Opening != "" {
+		q.add("g.opening ILIKE %s", escapeLike(filter.Opening)+"%")
+	}
+
+	return q
+}
+
+// GetGamesFromUser returns a page of the games of the user that match the filter, most recent first.
+// after is the cursor of the last game of the previous page, nil for the first page
+func (repo *GameRepo) GetGamesFromUser(ctx context.Context, filter GameFilter, after *PageCursor, limit int) ([]models.Game, error) {
+	q := filter.conditions()
+	q.addCursor(after, "g.started_at", "g.game_id")
+
 	query := `
-    SELECT 
-        g.*,
-        u_white.username AS white_username,
-        u_black.username AS black_username
+    SELECT
+        ` + gameColumnsWithUsernames + `
     FROM chess.game g
     JOIN chess.user u_white ON g.white_id = u_white.user_id
     JOIN chess.user u_black ON g.black_id = u_black.user_id
-    WHERE g.white_id = $1 OR g.black_id = $1
-    ORDER BY g.started_at DESC
-    LIMIT $2;`
+    ` + q.where() + `
+    ORDER BY g.started_at DESC, g.game_id DESC
+    LIMIT ` + q.arg(limit) + `;`
 
-	rows, err := repo.dbPool.Query(ctx, query, userID, limit)
+	rows, err := repo.dbPool.Query(ctx, query, q.args...)
 	if err == pgx.ErrNoRows {
 		return make([]models.Game, 0), nil
 	}
@@ -82,20 +196,75 @@ func (repo *GameRepo) GetGamesFromUser(ctx context.Context, userID uuid.UUID, li
 	var games []models.Game
 	for rows.Next() {
 		var game models.Game
-		err := rows.Scan(
-			&game.ID,
-			&game.WhiteID,
-			&game.BlackID,
-			&game.PGN,
-			&game.Status,
-			&game.Result,
-			&game.ResultReason,
-			&game.LastFEN,
-			&game.StartedAt,
-			&game.EndedAt,
-			&game.WhiteUsername,
-			&game.BlackUsername,
-		)
+		err := scanGameWithUsernames(rows, &game)
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, game)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return games, nil
+}
+
+// CountGamesFromUser returns how many games of the user match the filter
+func (repo *GameRepo) CountGamesFromUser(ctx context.Context, filter GameFilter) (int, error) {
+	q := filter.conditions()
+
+	query := `
+    SELECT COUNT(*)
+    FROM chess.game g
+    JOIN chess.user u_white ON g.white_id = u_white.user_id
+    JOIN chess.user u_black ON g.black_id = u_black.user_id
+    ` + q.where() + `;`
+
+	var count int
+	err := repo.dbPool.QueryRow(ctx, query, q.args...).Scan(&count)
+	return count, err
+}
+
+// GetColorBalance returns how many more games the user played as white than as black among its last games
+func (repo *GameRepo) GetColorBalance(ctx context.Context, userID uuid.UUID, limit int) (int, error) {
+	query := `
+    SELECT COALESCE(SUM(CASE WHEN white_id = $1 THEN 1 ELSE -1 END), 0)
+    FROM (
+        SELECT white_id FROM chess.game
+        WHERE (white_id = $1 OR black_id = $1) AND result <> 'aborted'
+        ORDER BY started_at DESC
+        LIMIT $2
+    ) recent;`
+
+	var balance int
+	err := repo.dbPool.QueryRow(ctx, query, userID, limit).Scan(&balance)
+	if err != nil {
+		return 0, err
+	}
+
+	return balance, nil
+}
+
+func (repo *GameRepo) GetGamesInProgress(ctx context.Context) ([]models.Game, error) {
+	query := `
+    SELECT
+        ` + gameColumnsWithUsernames + `
+    FROM chess.game g
+    JOIN chess.user u_white ON g.white_id = u_white.user_id
+    JOIN chess.user u_black ON g.black_id = u_black.user_id
+    WHERE g.status = 'in_progress';`
+
+	rows, err := repo.dbPool.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var games []models.Game
+	for rows.Next() {
+		var game models.Game
+		err := scanGameWithUsernames(rows, &game)
 		if err != nil {
 			return nil, err
 		}
@@ -109,30 +278,204 @@ func (repo *GameRepo) GetGamesFromUser(ctx context.Context, userID uuid.UUID, li
 	return games, nil
 }
 
+// UpdateGame updates a game and, in the same transaction, the ratings of both players
+// if it's a rated game that just got a result
 func (repo *GameRepo) UpdateGame(ctx context.Context, game *models.Game) error {
-	query := `UPDATE chess.game SET white_id=$2, black_id=$3, pgn=$4, status=$5, result=$6, last_fen=$7, started_at=$8, ended_at=$9, result_reason=$10 WHERE game_id=$1 RETURNING *;`
+	tx, err := repo.dbPool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var previousResult string
+	var rated bool
+	var timeCategory string
+	err = tx.QueryRow(ctx, `SELECT result, rated, time_category FROM chess.game WHERE game_id=$1 FOR UPDATE;`, game.ID).Scan(
+		&previousResult, &rated, &timeCategory,
+	)
+	if err != nil {
+		return err
+	}
+
+	if rated && previousResult == "in_progress" && (game.Result == "white" || game.Result == "black" || game.Result == "draw") {
+		err = updateRatings(ctx, tx, game, timeCategory)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `UPDATE chess.game SET white_id=$2, black_id=$3, pgn=$4, status=$5, result=$6, last_fen=$7, started_at=$8, ended_at=$9, result_reason=$10, white_time_ms=$11, black_time_ms=$12,
+			  white_rating_before=$13, white_rating_after=$14, black_rating_before=$15, black_rating_after=$16, eco=$17, opening=$18 WHERE game_id=$1 RETURNING *;`
+
+	_, err = tx.Exec(ctx, query, game.ID, game.WhiteID, game.BlackID, game.PGN, game.Status, game.Result, game.LastFEN, game.StartedAt, game.EndedAt, game.ResultReason, game.WhiteTimeMs, game.BlackTimeMs,
+		game.WhiteRatingBefore, game.WhiteRatingAfter, game.BlackRatingBefore, game.BlackRatingAfter, game.ECO, game.Opening)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// updateRatings applies the result of the game to the Glicko-2 ratings of both players in its time category,
+// storing the ratings before and after the game in the model
+func updateRatings(ctx context.Context, tx pgx.Tx, game *models.Game, timeCategory string) error {
+	_, err := tx.Exec(ctx, `INSERT INTO chess.user_rating(user_id, category) VALUES ($1, $3), ($2, $3) ON CONFLICT DO NOTHING;`,
+		game.WhiteID, game.BlackID, timeCategory)
+	if err != nil {
+		return err
+	}
 
-	_, err := repo.dbPool.Exec(ctx, query, game.ID, game.WhiteID, game.BlackID, game.PGN, game.Status, game.Result, game.LastFEN, game.StartedAt, game.EndedAt, game.ResultReason)
+	// Rows are always locked in the same order to avoid deadlocks between concurrent games
+	rows, err := tx.Query(ctx, `SELECT * FROM chess.user_rating WHERE user_id IN ($1, $2) AND category=$3 ORDER BY user_id FOR UPDATE;`,
+		game.WhiteID, game.BlackID, timeCategory)
 	if err != nil {
 		return err
 	}
+	current, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.UserRating])
+	if err != nil {
+		return err
+	}
+
+	var white, black ratings.Rating
+	for _, r := range current {
+		rating := ratings.Rating{Rating: r.Rating, Deviation: r.Deviation, Volatility: r.Volatility}
+		if r.ID == game.WhiteID {
+			white = rating
+		} else {
+			black = rating
+		}
+	}
 
+	whiteScore := 0.5
+	switch game.Result {
+	case "white":
+		whiteScore = 1
+	case "black":
+		whiteScore = 0
+	}
+
+	newWhite := ratings.Update(white, black, whiteScore)
+	newBlack := ratings.Update(black, white, 1-whiteScore)
+
+	query := `UPDATE chess.user_rating SET rating=$3, deviation=$4, volatility=$5, games_played=games_played+1, last_updated=NOW() WHERE user_id=$1 AND category=$2;`
+	_, err = tx.Exec(ctx, query, game.WhiteID, timeCategory, newWhite.Rating, newWhite.Deviation, newWhite.Volatility)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, query, game.BlackID, timeCategory, newBlack.Rating, newBlack.Deviation, newBlack.Volatility)
+	if err != nil {
+		return err
+	}
+
+	game.WhiteRatingBefore = &white.Rating
+	game.WhiteRatingAfter = &newWhite.Rating
+	game.BlackRatingBefore = &black.Rating
+	game.BlackRatingAfter = &newBlack.Rating
 	return nil
 }
 
-func (repo *GameRepo) CreateNewGame(ctx context.Context, gameID uuid.UUID, whiteID uuid.UUID, blackID uuid.UUID, pgn string, status string, result string, lastFen string, startedAt time.Time, endedAt time.Time, resultReason string) (*models.Game, error) {
-	query := `INSERT INTO chess.game(game_id, white_id, black_id, pgn, status, result, last_fen, started_at, ended_at, result_reason) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING *;`
+// SaveGameProgress stores the moves and clocks of a game that is still in progress
+func (repo *GameRepo) SaveGameProgress(ctx context.Context, gameID uuid.UUID, pgn string, lastFen string, whiteTimeMs int64, blackTimeMs int64) error {
+	query := `UPDATE chess.game SET pgn=$2, last_fen=$3, white_time_ms=$4, black_time_ms=$5 WHERE game_id=$1 AND status='in_progress';`
 
-	rows, err := repo.dbPool.Query(ctx, query, gameID, whiteID, blackID, pgn, status, result, lastFen, startedAt, endedAt, resultReason)
+	_, err := repo.dbPool.Exec(ctx, query, gameID, pgn, lastFen, whiteTimeMs, blackTimeMs)
+	return err
+}
+
+func (repo *GameRepo) CreateNewGame(ctx context.Context, game *models.Game) (*models.Game, error) {
+	query := `INSERT INTO chess.game(game_id, white_id, black_id, pgn, status, result, last_fen, started_at, ended_at, result_reason, rated, clock_base_ms, clock_increment_ms, clock_delay_ms, white_time_ms, black_time_ms, time_category, variant, initial_fen, bot_level) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20) RETURNING *;`
+
+	rows, err := repo.dbPool.Query(ctx, query, game.ID, game.WhiteID, game.BlackID, game.PGN, game.Status, game.Result, game.LastFEN, game.StartedAt, game.EndedAt, game.ResultReason, game.Rated, game.ClockBaseMs, game.IncrementMs, game.DelayMs, game.WhiteTimeMs, game.BlackTimeMs, game.TimeCategory, game.Variant, game.InitialFEN, game.BotLevel)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	game, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Game])
+	newGame, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.Game])
 	if err != nil {
 		return nil, err
 	}
 
-	return &game, nil
+	return &newGame, nil
+}
+
+// AddGameMove stores a move of a game. A move that was taken back is overwritten by the new one played at the same ply
+func (repo *GameRepo) AddGameMove(ctx context.Context, move *models.GameMove) error {
+	query := `INSERT INTO chess.game_move(game_id, ply, san, uci, fen, played_at, white_time_ms, black_time_ms) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			  ON CONFLICT (game_id, ply) DO UPDATE SET san=EXCLUDED.san, uci=EXCLUDED.uci, fen=EXCLUDED.fen, played_at=EXCLUDED.played_at, white_time_ms=EXCLUDED.white_time_ms, black_time_ms=EXCLUDED.black_time_ms;`
+
+	_, err := repo.dbPool.Exec(ctx, query, move.GameID, move.Ply, move.SAN, move.UCI, move.FEN, move.PlayedAt, move.WhiteTimeMs, move.BlackTimeMs)
+	return err
+}
+
+// DeleteGameMovesAfter removes every move of a game played after the given ply
+func (repo *GameRepo) DeleteGameMovesAfter(ctx context.Context, gameID uuid.UUID, ply int) error {
+	query := `DELETE FROM chess.game_move WHERE game_id=$1 AND ply > $2;`
+
+	_, err := repo.dbPool.Exec(ctx, query, gameID, ply)
+	return err
+}
+
+func (repo *GameRepo) GetGameMoves(ctx context.Context, gameID uuid.UUID) ([]models.GameMove, error) {
+	query := `SELECT * FROM chess.game_move WHERE game_id=$1 ORDER BY ply ASC;`
+
+	rows, err := repo.dbPool.Query(ctx, query, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	moves, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.GameMove])
+	if err != nil {
+		return nil, err
+	}
+
+	return moves, nil
+}
+
+// GetMovesOfGames returns the moves of several games at once, by game, in ply order
+func (repo *GameRepo) GetMovesOfGames(ctx context.Context, gameIDs []uuid.UUID) (map[uuid.UUID][]models.GameMove, error) {
+	query := `SELECT * FROM chess.game_move WHERE game_id = ANY($1) ORDER BY game_id, ply ASC;`
+
+	rows, err := repo.dbPool.Query(ctx, query, gameIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	moves, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.GameMove])
+	if err != nil {
+		return nil, err
+	}
+
+	byGame := make(map[uuid.UUID][]models.GameMove, len(gameIDs))
+	for _, move := range moves {
+		byGame[move.GameID] = append(byGame[move.GameID], move)
+	}
+	return byGame, nil
+}
+
+// AddChatMessage stores a message of the chat of a game
+func (repo *GameRepo) AddChatMessage(ctx context.Context, message *models.ChatMessage) error {
+	query := `INSERT INTO chess.game_chat(game_id, user_id, channel, text, sent_at) VALUES ($1, $2, $3, $4, $5);`
+
+	_, err := repo.dbPool.Exec(ctx, query, message.GameID, message.UserID, message.Channel, message.Text, message.SentAt)
+	return err
+}
+
+// GetChatMessages returns the chat log of a game in the order it was sent, with the usernames of the senders
+func (repo *GameRepo) GetChatMessages(ctx context.Context, gameID uuid.UUID) ([]models.ChatMessage, error) {
+	query := `SELECT c.message_id, c.game_id, c.user_id, u.username, c.channel, c.text, c.sent_at
+		FROM chess.game_chat c
+		JOIN chess.user u ON u.user_id = c.user_id
+		WHERE c.game_id=$1
+		ORDER BY c.message_id ASC;`
+
+	rows, err := repo.dbPool.Query(ctx, query, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.ChatMessage])
 }
@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PageCursor is the sort key of the last row of a page, the next page starts right after it.
+// Lists are sorted by a timestamp and then by id, newest first
+type PageCursor struct {
+	Time time.Time
+	ID   uuid.UUID
+}
+
+// queryConditions collects the WHERE conditions of a query along with their arguments
+type queryConditions struct {
+	conditions []string
+	args       []any
+}
+
+// arg adds an argument and returns its placeholder
+func (q *queryConditions) arg(value any) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+// add adds a condition, where each %s is replaced by the placeholder of the next value
+func (q *queryConditions) add(condition string, values ...any) {
+	placeholders := make([]any, len(values))
+	for i, value := range values {
+		placeholders[i] = q.arg(value)
+	}
+	q.conditions = append(q.conditions, fmt.Sprintf(condition, placeholders...))
+}
+
+// addCursor keeps the rows after the cursor, for the given timestamp and id columns
+func (q *queryConditions) addCursor(after *PageCursor, timeColumn string, idColumn string) {
+	if after != nil {
+		q.add("("+timeColumn+", "+idColumn+") < (%s, %s)", after.Time, after.ID)
+	}
+}
+
+func (q *queryConditions) where() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, so the text is matched as is
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text)
+}
@@ -3,6 +3,7 @@ package repositories
 import (
 	"context"
 	"database/models"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -36,10 +37,37 @@ func (repo *SavedGameRepo) GetGame(ctx context.Context, gameID uuid.UUID) (*mode
 	return &savedGame, nil
 }
 
-func (repo *SavedGameRepo) GetGamesFromUser(ctx context.Context, userID uuid.UUID, limit int) ([]models.SavedGame, error) {
-	query := `SELECT * FROM chess.saved_game WHERE user_id=$1 ORDER BY created_at DESC LIMIT $2;`
+// SavedGameFilter narrows down the saved games of a user, fields left at their zero value don't filter
+type SavedGameFilter struct {
+	UserID uuid.UUID
+	Name   string    // Part of the name, case insensitive
+	From   time.Time // Games saved at or after From
+	To     time.Time // Games saved before To
+}
 
-	rows, err := repo.dbPool.Query(ctx, query, userID.String(), limit)
+func (filter *SavedGameFilter) conditions() *queryConditions {
+	q := &queryConditions{}
+	q.add("user_id = %s", filter.UserID)
+	if filter.Name != "" {
+		q.add("name ILIKE %s", "%"+escapeLike(filter.Name)+"%")
+	}
+	if !filter.From.IsZero() {
+		q.add("created_at >= %s", filter.From)
+	}
+	if !filter.To.IsZero() {
+		q.add("created_at < %s", filter.To)
+	}
+	return q
+}
+
+// GetGamesFromUser returns a page of the saved games of the user that match the filter, most recent first.
+// after is the cursor of the last game of the previous page, nil for the first page
+func (repo *SavedGameRepo) GetGamesFromUser(ctx context.Context, filter SavedGameFilter, after *PageCursor, limit int) ([]models.SavedGame, error) {
+	q := filter.conditions()
+	q.addCursor(after, "created_at", "game_id")
+	query := `SELECT * FROM chess.saved_game ` + q.where() + ` ORDER BY created_at DESC, game_id DESC LIMIT ` + q.arg(limit) + `;`
+
+	rows, err := repo.dbPool.Query(ctx, query, q.args...)
 
 	if err != nil {
 		return nil, err
@@ -54,6 +82,16 @@ func (repo *SavedGameRepo) GetGamesFromUser(ctx context.Context, userID uuid.UUI
 	return savedGames, nil
 }
 
+// CountGamesFromUser returns how many saved games of the user match the filter
+func (repo *SavedGameRepo) CountGamesFromUser(ctx context.Context, filter SavedGameFilter) (int, error) {
+	q := filter.conditions()
+	query := `SELECT COUNT(*) FROM chess.saved_game ` + q.where() + `;`
+
+	var count int
+	err := repo.dbPool.QueryRow(ctx, query, q.args...).Scan(&count)
+	return count, err
+}
+
 func (repo *SavedGameRepo) UpdateGame(ctx context.Context, savedGame *models.SavedGame) error {
 	query := `UPDATE chess.saved_game SET name=$3, pgn=$4, last_fen=$5 WHERE game_id = $1 and user_id = $2 RETURNING *;`
 
@@ -92,6 +130,52 @@ func (repo *SavedGameRepo) CreateNewGame(ctx context.Context, userID uuid.UUID,
 	return &savedGame, nil
 }
 
+// ImportGame saves a game imported from a PGN file, unless the user already imported a game with the same
+// content hash. In that case created is false and the game imported before is returned
+func (repo *SavedGameRepo) ImportGame(ctx context.Context, userID uuid.UUID, name string, pgn string, lastFEN string, contentHash string) (*models.SavedGame, bool, error) {
+	query := `INSERT INTO chess.saved_game(user_id, name, pgn, last_fen, content_hash) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (user_id, content_hash) WHERE content_hash IS NOT NULL DO NOTHING
+	RETURNING *;`
+
+	rows, err := repo.dbPool.Query(ctx, query, userID, name, pgn, lastFEN, contentHash)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	savedGame, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.SavedGame])
+	if err == pgx.ErrNoRows {
+		existing, err := repo.GetGameByHash(ctx, userID, contentHash)
+		if err == nil && existing == nil {
+			err = pgx.ErrNoRows
+		}
+		return existing, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &savedGame, true, nil
+}
+
+// GetGameByHash returns the game the user imported with the given content hash, nil if there's none
+func (repo *SavedGameRepo) GetGameByHash(ctx context.Context, userID uuid.UUID, contentHash string) (*models.SavedGame, error) {
+	rows, err := repo.dbPool.Query(ctx, `SELECT * FROM chess.saved_game WHERE user_id=$1 AND content_hash=$2;`, userID, contentHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	savedGame, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.SavedGame])
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &savedGame, nil
+}
+
 func (repo *SavedGameRepo) DeleteGame(ctx context.Context, gameID uuid.UUID) (bool, error) {
 	query := `DELETE FROM chess.saved_game WHERE game_id = $1;`
 
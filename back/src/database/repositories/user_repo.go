@@ -58,9 +58,85 @@ func (repo *UserRepo) GetUserWithStats(ctx context.Context, userID uuid.UUID) (*
 		return nil, err
 	}
 
+	user.Stats.Ratings, err = repo.GetUserRatings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
 	return &user, nil
 }
 
+func (repo *UserRepo) GetUserRatings(ctx context.Context, userID uuid.UUID) ([]models.UserRating, error) {
+	query := `SELECT * FROM chess.user_rating WHERE user_id=$1 ORDER BY category;`
+
+	rows, err := repo.dbPool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userRatings, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.UserRating])
+	if err != nil {
+		return nil, err
+	}
+
+	return userRatings, nil
+}
+
+// GetUserRating returns the rating of the user in a time category, or nil if it never played a rated game in it
+func (repo *UserRepo) GetUserRating(ctx context.Context, userID uuid.UUID, category string) (*models.UserRating, error) {
+	query := `SELECT * FROM chess.user_rating WHERE user_id=$1 AND category=$2;`
+
+	rows, err := repo.dbPool.Query(ctx, query, userID, category)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rating, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.UserRating])
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &rating, nil
+}
+
+// GetUserOpeningStats returns the results of the user in the openings it played most, by color.
+// Like the other stats, only finished games between players count
+func (repo *UserRepo) GetUserOpeningStats(ctx context.Context, userID uuid.UUID, limit int) ([]models.OpeningStats, error) {
+	query := `SELECT
+			eco, opening,
+			CASE WHEN white_id = $1 THEN 'white' ELSE 'black' END AS color,
+			COUNT(*) AS games,
+			COUNT(*) FILTER (WHERE (result = 'white' AND white_id = $1) OR (result = 'black' AND black_id = $1)) AS wins,
+			COUNT(*) FILTER (WHERE result = 'draw') AS draws,
+			COUNT(*) FILTER (WHERE (result = 'black' AND white_id = $1) OR (result = 'white' AND black_id = $1)) AS losses
+		FROM chess.game
+		WHERE (white_id = $1 OR black_id = $1) AND status = 'ended' AND result <> 'aborted' AND bot_level = 0 AND eco <> ''
+		GROUP BY eco, opening, color
+		ORDER BY games DESC, eco ASC
+		LIMIT $2;`
+
+	rows, err := repo.dbPool.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.OpeningStats])
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range stats {
+		stats[i].WinRate = float64(stats[i].Wins) / float64(stats[i].Games)
+	}
+	return stats, nil
+}
+
 func (repo *UserRepo) GetUserStats(ctx context.Context, userID uuid.UUID) (*models.UserStats, error) {
 	query := `SELECT * FROM chess.user_stats WHERE user_id=$1;`
 
@@ -153,6 +229,22 @@ func (repo *UserRepo) CheckUsernameOrEmailExistence(ctx context.Context, usernam
 	return usernameExists, emailExists, nil
 }
 
+// GetUserRole returns the role of the user, "user" or "moderator". Users that don't exist get an empty role
+func (repo *UserRepo) GetUserRole(ctx context.Context, userID uuid.UUID) (string, error) {
+	query := `SELECT role FROM chess.user WHERE user_id=$1;`
+
+	role := ""
+	err := repo.dbPool.QueryRow(ctx, query, userID).Scan(&role)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return role, nil
+}
+
 func (repo *UserRepo) GetUserByID(ctx context.Context, userID uuid.UUID, includeCredentials bool) (*models.User, error) {
 	query := `SELECT user_id, username, email, created_at, password_hash FROM chess.user WHERE user_id=$1;`
 
@@ -0,0 +1,236 @@
+package engine
+
+import (
+	"math/rand/v2"
+	"sort"
+	"time"
+
+	"github.com/corentings/chess/v2"
+)
+
+// Level is how strong the built-in engine plays, from MinLevel to MaxLevel
+type Level int
+
+const (
+	MinLevel Level = 1
+	MaxLevel Level = 8
+)
+
+type levelSettings struct {
+	depth    int           // Deepest full-width search, in plies
+	moveTime time.Duration // Longest the engine thinks about a single move
+	noise    int           // Up to this many centipawns are randomly added to each root move, weaker levels blunder more
+}
+
+var levels = [...]levelSettings{
+	1: {depth: 1, moveTime: 200 * time.Millisecond, noise: 300},
+	2: {depth: 1, moveTime: 300 * time.Millisecond, noise: 150},
+	3: {depth: 2, moveTime: 500 * time.Millisecond, noise: 100},
+	4: {depth: 2, moveTime: time.Second, noise: 50},
+	5: {depth: 3, moveTime: time.Second, noise: 25},
+	6: {depth: 3, moveTime: 2 * time.Second, noise: 10},
+	7: {depth: 4, moveTime: 3 * time.Second, noise: 0},
+	8: {depth: 5, moveTime: 5 * time.Second, noise: 0},
+}
+
+const (
+	mateScore       = 100000
+	infinity        = mateScore + 1
+	quiescenceDepth = 4
+)
+
+// Valid reports whether the level is one the engine knows
+func (l Level) Valid() bool {
+	return l >= MinLevel && l <= MaxLevel
+}
+
+type searcher struct {
+	deadline time.Time // Zero while the search must not be interrupted
+	nodes    int
+	stopped  bool
+}
+
+// Search chooses the move to play in the position. The engine thinks at most budget, or the time
+// allowed by its level if that is shorter. It returns nil if there are no legal moves
+func Search(pos *chess.Position, level Level, budget time.Duration) *chess.Move {
+	if !level.Valid() {
+		level = MaxLevel
+	}
+	settings := levels[level]
+
+	moves := pos.ValidMoves()
+	if len(moves) == 0 {
+		return nil
+	}
+	orderMoves(pos, moves)
+
+	if budget <= 0 || budget > settings.moveTime {
+		budget = settings.moveTime
+	}
+	deadline := time.Now().Add(budget)
+	s := &searcher{}
+
+	best := &moves[0]
+	for depth := 1; depth <= settings.depth; depth++ {
+		bestScore := -infinity
+		var bestMove *chess.Move
+
+		for i := range moves {
+			alpha := -infinity
+			if bestScore > -infinity {
+				// Moves that can't catch up with the best one even with the most noise only need a bound
+				alpha = bestScore - settings.noise - 1
+			}
+
+			score := -s.negamax(pos.Update(&moves[i]), depth-1, -infinity, -alpha, 1)
+			if s.stopped {
+				break
+			}
+			if settings.noise > 0 {
+				score += rand.IntN(settings.noise + 1)
+			}
+
+			if score > bestScore {
+				bestScore = score
+				bestMove = &moves[i]
+			}
+		}
+
+		if s.stopped {
+			break
+		}
+		best = bestMove
+
+		// Search the best move first in the next iteration
+		for i := range moves {
+			if &moves[i] == best {
+				moves[0], moves[i] = moves[i], moves[0]
+				best = &moves[0]
+				break
+			}
+		}
+
+		// The first iteration always completes, so there is a move to play
+		s.deadline = deadline
+	}
+
+	move := *best
+	return &move
+}
+
+// timeUp reports whether the search should stop. The clock is only checked every few nodes
+func (s *searcher) timeUp() bool {
+	s.nodes++
+	if s.nodes%1024 == 0 && !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		s.stopped = true
+	}
+	return s.stopped
+}
+
+// negamax returns the score of the position for the side to move, searching depth plies with alpha-beta pruning
+func (s *searcher) negamax(pos *chess.Position, depth int, alpha int, beta int, ply int) int {
+	if s.timeUp() {
+		return 0
+	}
+
+	moves := pos.ValidMoves()
+	if len(moves) == 0 {
+		return terminalScore(pos, ply)
+	}
+	if pos.HalfMoveClock() >= 100 {
+		return 0
+	}
+	if depth <= 0 {
+		return s.quiescence(pos, alpha, beta, ply, quiescenceDepth)
+	}
+
+	orderMoves(pos, moves)
+	for i := range moves {
+		score := -s.negamax(pos.Update(&moves[i]), depth-1, -beta, -alpha, ply+1)
+		if s.stopped {
+			return 0
+		}
+		if score >= beta {
+			return beta
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	return alpha
+}
+
+// quiescence keeps searching captures and promotions past the full-width depth, so the evaluation
+// isn't taken in the middle of an exchange
+func (s *searcher) quiescence(pos *chess.Position, alpha int, beta int, ply int, depth int) int {
+	if s.timeUp() {
+		return 0
+	}
+
+	standPat := evaluate(pos)
+	if standPat >= beta || depth == 0 {
+		return standPat
+	}
+	if standPat > alpha {
+		alpha = standPat
+	}
+
+	moves := pos.ValidMoves()
+	if len(moves) == 0 {
+		return terminalScore(pos, ply)
+	}
+
+	orderMoves(pos, moves)
+	for i := range moves {
+		if !moves[i].HasTag(chess.Capture) && moves[i].Promo() == chess.NoPieceType {
+			continue
+		}
+
+		score := -s.quiescence(pos.Update(&moves[i]), -beta, -alpha, ply+1, depth-1)
+		if s.stopped {
+			return 0
+		}
+		if score >= beta {
+			return beta
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	return alpha
+}
+
+// terminalScore scores a position without legal moves. Quicker mates score higher
+func terminalScore(pos *chess.Position, ply int) int {
+	if pos.Status() == chess.Checkmate {
+		return -mateScore + ply
+	}
+	return 0
+}
+
+// orderMoves sorts the moves most likely to be good first, which makes alpha-beta prune more:
+// promotions, then captures of valuable pieces by cheap ones, then checks
+func orderMoves(pos *chess.Position, moves []chess.Move) {
+	board := pos.Board()
+	priority := func(m *chess.Move) int {
+		p := 0
+		if m.Promo() != chess.NoPieceType {
+			p += 10 * pieceValues[m.Promo()]
+		}
+		if m.HasTag(chess.Capture) {
+			victim := pieceValues[chess.Pawn]
+			if piece := board.Piece(m.S2()); piece != chess.NoPiece {
+				victim = pieceValues[piece.Type()]
+			}
+			p += 10*victim - pieceValues[board.Piece(m.S1()).Type()]/10
+		}
+		if m.HasTag(chess.Check) {
+			p += 50
+		}
+		return p
+	}
+
+	sort.SliceStable(moves, func(i, j int) bool {
+		return priority(&moves[i]) > priority(&moves[j])
+	})
+}
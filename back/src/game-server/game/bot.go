@@ -0,0 +1,146 @@
+package game
+
+import (
+	"context"
+	"fmt"
+	"game-server/engine"
+	"time"
+	"utils/uci"
+
+	"github.com/corentings/chess/v2"
+	"github.com/google/uuid"
+)
+
+// BotUserID is the reserved user that games against the built-in engine are stored with
+var BotUserID = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+const botUsername = "computer"
+
+// Search depth of the UCI engine at each bot level
+var uciBotDepths = map[engine.Level]int{1: 1, 2: 2, 3: 3, 4: 4, 5: 6, 6: 8, 7: 12, 8: 18}
+
+// newBotPlayer creates a player for the built-in engine. It has no WebSocket: the messages a human
+// would get are read by runBot, which answers them through the same Game methods a human would call.
+// Every bot game gets its own bot player, they are not kept in GameManager.players
+func newBotPlayer(gm *GameManager, level engine.Level) *Player {
+	p := NewPlayer(gm, BotUserID, botUsername)
+	p.Connected = true
+	p.initMessageReceived = true
+	p.botLevel = level
+
+	channel := make(chan Message, 100)
+	p.wsChannel = &channel
+	go p.runBot(channel)
+	return p
+}
+
+// IsBot reports whether the player is the built-in engine
+func (p *Player) IsBot() bool {
+	return p.botLevel != 0
+}
+
+// runBot reacts to the messages of the bot's game until it's told to quit
+func (p *Player) runBot(channel chan Message) {
+	for {
+		message := <-channel
+
+		switch message.Type {
+		case "quit":
+			return
+		case "game_started", "player_moved", "takeback":
+			p.playBotMove()
+		case "draw_offered":
+			if game := p.botGame(); game != nil {
+				game.DeclineDraw(p)
+			}
+		case "takeback_requested":
+			if game := p.botGame(); game != nil {
+				game.AcceptTakeback(p)
+			}
+		case "rematch_offered":
+			if game := p.botGame(); game != nil {
+				game.AcceptRematch(p)
+			}
+		}
+	}
+}
+
+func (p *Player) botGame() *Game {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.OngoingGame
+}
+
+// playBotMove searches a move if it's the bot's turn and plays it. The engine gets a share of the
+// time left on the clock, so the bot doesn't lose on time
+func (p *Player) playBotMove() {
+	game := p.botGame()
+	if game == nil {
+		return
+	}
+
+	game.mutex.RLock()
+	color, _ := game.playerNoLock(p)
+	fen := game.game.Position().String()
+	ongoing := game.Status == GameOngoing
+	budget := game.clock.Remaining(color, time.Now())/40 + game.clock.control.Increment/2
+	game.mutex.RUnlock()
+
+	if !ongoing {
+		return
+	}
+
+	// The engine works on its own copy of the position, library positions cache their moves
+	fenOption, err := chess.FEN(fen)
+	if err != nil {
+		return
+	}
+	pos := chess.NewGame(fenOption).Position()
+	if pos.Turn() != color {
+		return
+	}
+
+	move := p.searchBotMove(pos, budget)
+	if move == nil {
+		return
+	}
+
+	// The human may have taken back a move while the engine was thinking
+	game.mutex.RLock()
+	stale := game.game.Position().String() != fen
+	game.mutex.RUnlock()
+	if stale {
+		return
+	}
+
+	game.SendMove(p, PlayerMovedMessage{
+		MoveS1:       move.S1().String(),
+		MoveS2:       move.S2().String(),
+		MoveNotation: chess.AlgebraicNotation{}.Encode(pos, move),
+	})
+}
+
+// searchBotMove asks the configured UCI engine for a move, or the built-in engine if there is none
+// or the UCI engine failed. Weaker levels search the UCI engine less deep
+func (p *Player) searchBotMove(pos *chess.Position, budget time.Duration) *chess.Move {
+	if p.gm.config.BotEngine != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), budget+time.Second)
+		defer cancel()
+
+		result, err := p.gm.config.BotEngine.Analyse(ctx, uci.Request{
+			FEN:      pos.String(),
+			Depth:    uciBotDepths[p.botLevel],
+			MoveTime: budget,
+		})
+		if err == nil {
+			var move *chess.Move
+			move, err = chess.UCINotation{}.Decode(pos, result.BestMove)
+			if err == nil {
+				return move
+			}
+		}
+		fmt.Printf("UCI engine failed, the built-in engine plays instead: %v\n", err)
+	}
+
+	return engine.Search(pos, p.botLevel, budget)
+}
@@ -0,0 +1,168 @@
+package game
+
+import (
+	"context"
+	"database/models"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/corentings/chess/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// Longest chat message, in characters
+	maxChatLength = 140
+	// Most chat messages a user may send in a game during chatRateWindow
+	chatRateLimit  = 5
+	chatRateWindow = 10 * time.Second
+)
+
+// Chat posts a message in the chat of the game. Players chat with each other, and spectators see their messages
+// with the same delay as the moves. Spectators have a channel of their own, that players don't see.
+// Every message is stored, so that moderators can review the chat of a game later
+func (g *Game) Chat(player *Player, text string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	channel := "spectator"
+	color := chess.NoColor
+	var opponent *Player
+	if !player.spectator {
+		color, opponent = g.playerNoLock(player)
+	}
+	if color != chess.NoColor {
+		channel = "player"
+	} else if g.Spectators[player.ID] != player {
+		return false
+	}
+
+	text, reason := sanitizeChat(text)
+	if reason != "" {
+		rejectChat(player, reason)
+		return true
+	}
+
+	now := time.Now()
+	if !g.allowChatNoLock(player.ID, now) {
+		rejectChat(player, "Too many messages, wait a few seconds")
+		return true
+	}
+
+	chatMessage := &models.ChatMessage{
+		GameID:  g.ID,
+		UserID:  player.ID,
+		Channel: channel,
+		Text:    text,
+		SentAt:  now,
+	}
+	g.queueWrite(func(ctx context.Context) {
+		err := g.gm.gameRepo.AddChatMessage(ctx, chatMessage)
+		if err != nil {
+			fmt.Printf("Failed to save chat message of game %s: %v\n", g.ID, err)
+		}
+	})
+
+	jsonData, err := json.Marshal(ChatPostedMessage{
+		UserID:   player.ID.String(),
+		Username: player.Username,
+		Channel:  channel,
+		Text:     text,
+	})
+	if err != nil {
+		panic(err)
+	}
+	message := Message{
+		Type: "chat",
+		Data: string(jsonData),
+	}
+
+	if channel == "spectator" {
+		g.sendToSpectatorsNoLock(message)
+		return true
+	}
+
+	player.SendMessage(message)
+	if !g.muted[color.Other()] {
+		opponent.SendMessage(message)
+	}
+	g.broadcastToSpectatorsNoLock(message)
+	return true
+}
+
+// SetMuted stops the chat messages of the opponent from reaching the player, or lets them through again
+func (g *Game) SetMuted(player *Player, muted bool) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	color, _ := g.playerNoLock(player)
+	if color == chess.NoColor {
+		return false
+	}
+	g.muted[color] = muted
+
+	jsonData, err := json.Marshal(MutedMessage{
+		Muted: muted,
+	})
+	if err != nil {
+		panic(err)
+	}
+	player.SendMessage(Message{
+		Type: "muted",
+		Data: string(jsonData),
+	})
+	return true
+}
+
+// allowChatNoLock counts a message of the user against its rate limit, false if it's over the limit
+func (g *Game) allowChatNoLock(userID uuid.UUID, now time.Time) bool {
+	recent := g.chatSent[userID][:0]
+	for _, sentAt := range g.chatSent[userID] {
+		if now.Sub(sentAt) < chatRateWindow {
+			recent = append(recent, sentAt)
+		}
+	}
+
+	if len(recent) >= chatRateLimit {
+		g.chatSent[userID] = recent
+		return false
+	}
+	g.chatSent[userID] = append(recent, now)
+	return true
+}
+
+// sanitizeChat trims a chat message, and returns why it's refused if it is
+func sanitizeChat(text string) (string, string) {
+	text = strings.TrimSpace(text)
+
+	switch {
+	case text == "":
+		return "", "Message is empty"
+	case !utf8.ValidString(text):
+		return "", "Message is not valid UTF-8"
+	case utf8.RuneCountInString(text) > maxChatLength:
+		return "", fmt.Sprintf("Message is too big (has to be at most %d chars wide)", maxChatLength)
+	case strings.ContainsAny(text, "<>"):
+		return "", "Message contains blacklisted chars (< or >)"
+	case strings.IndexFunc(text, unicode.IsControl) >= 0:
+		return "", "Message contains control chars"
+	}
+	return text, ""
+}
+
+func rejectChat(player *Player, reason string) {
+	jsonData, err := json.Marshal(ChatRejectedMessage{
+		Reason: reason,
+	})
+	if err != nil {
+		panic(err)
+	}
+	player.SendMessage(Message{
+		Type: "chat_rejected",
+		Data: string(jsonData),
+	})
+}
@@ -0,0 +1,375 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"utils/openings"
+
+	"github.com/corentings/chess/v2"
+)
+
+// ply is a move already played, as it was sent to the players and stored in the move history
+type ply struct {
+	san string
+	uci string
+	s1  chess.Square
+	s2  chess.Square
+}
+
+// chessGame is the game on the board. The rules come from the chess library, except for Chess960
+// castling: the library only knows how to castle from the standard start position, so those castles
+// are applied here and the game goes on from the resulting position in a new library game (a segment).
+// Castling can't be undone, so no position that could repeat is lost between segments
+type chessGame struct {
+	variant    string
+	initialFEN string
+	segment    *chess.Game
+	plies      []ply
+	castling   map[chess.Square]bool // Chess960 only: rooks that may still castle
+	opening    *openings.Opening     // Standard games only: last named position the game went through
+}
+
+// pendingMove is a move checked against the current position, ready to be played
+type pendingMove struct {
+	san  string
+	uci  string
+	s1   chess.Square
+	s2   chess.Square
+	move *chess.Move
+	// Chess960 castles have no library move, the game continues from this FEN instead
+	castleFEN string
+}
+
+func newChessGame(variant string, initialFEN string) (*chessGame, error) {
+	cg := &chessGame{
+		variant:    variant,
+		initialFEN: initialFEN,
+		plies:      make([]ply, 0),
+	}
+
+	libraryFEN := initialFEN
+	switch variant {
+	case VariantStandard:
+		if initialFEN != standardFEN {
+			return nil, errors.New("standard games start from the standard position")
+		}
+	case VariantChess960:
+		castling, fen, err := parseChess960FEN(initialFEN)
+		if err != nil {
+			return nil, err
+		}
+		cg.castling = castling
+		libraryFEN = fen
+	case VariantFromPosition:
+	default:
+		return nil, errors.New("unsupported variant: " + variant)
+	}
+
+	fenOption, err := chess.FEN(libraryFEN)
+	if err != nil {
+		return nil, err
+	}
+	cg.segment = chess.NewGame(fenOption)
+	if cg.segment.Outcome() != chess.NoOutcome {
+		return nil, errors.New("the game is already over in the initial position")
+	}
+	return cg, nil
+}
+
+func (cg *chessGame) Position() *chess.Position {
+	return cg.segment.Position()
+}
+
+// FEN of the current position. The library never sees Chess960 castling rights, they're written
+// back in Shredder-FEN from the rooks that may still castle
+func (cg *chessGame) FEN() string {
+	fen := cg.segment.FEN()
+	if cg.variant != VariantChess960 {
+		return fen
+	}
+
+	fields := strings.Fields(fen)
+	fields[2] = shredderCastling(cg.castling)
+	return strings.Join(fields, " ")
+}
+
+func (cg *chessGame) ValidMoves() []chess.Move {
+	return cg.segment.ValidMoves()
+}
+
+func (cg *chessGame) Outcome() chess.Outcome {
+	return cg.segment.Outcome()
+}
+
+func (cg *chessGame) Method() chess.Method {
+	return cg.segment.Method()
+}
+
+func (cg *chessGame) Resign(color chess.Color) {
+	cg.segment.Resign(color)
+}
+
+func (cg *chessGame) Draw(method chess.Method) error {
+	return cg.segment.Draw(method)
+}
+
+func (cg *chessGame) EligibleDraws() []chess.Method {
+	return cg.segment.EligibleDraws()
+}
+
+// Plies returns how many moves were played by both sides
+func (cg *chessGame) Plies() int {
+	return len(cg.plies)
+}
+
+// FirstToMove returns the side to move in the initial position, black in some positions set up by the players
+func (cg *chessGame) FirstToMove() chess.Color {
+	if fields := strings.Fields(cg.initialFEN); len(fields) > 1 && fields[1] == "b" {
+		return chess.Black
+	}
+	return chess.White
+}
+
+// LastMove returns the squares of the last move played
+func (cg *chessGame) LastMove() (chess.Square, chess.Square, bool) {
+	if len(cg.plies) == 0 {
+		return chess.NoSquare, chess.NoSquare, false
+	}
+	last := cg.plies[len(cg.plies)-1]
+	return last.s1, last.s2, true
+}
+
+// String returns the PGN of the game. Games not played from the standard position carry
+// the [Variant], [SetUp] and [FEN] tags
+func (cg *chessGame) String() string {
+	if cg.variant == VariantStandard {
+		return cg.segment.String()
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[Variant \"%s\"]\n[SetUp \"1\"]\n[FEN \"%s\"]\n\n", pgnVariantNames[cg.variant], cg.initialFEN)
+
+	fields := strings.Fields(cg.initialFEN)
+	moveNumber, _ := strconv.Atoi(fields[5])
+	whiteToMove := fields[1] == "w"
+	for i, p := range cg.plies {
+		if whiteToMove {
+			fmt.Fprintf(&sb, "%d. ", moveNumber)
+		} else if i == 0 {
+			fmt.Fprintf(&sb, "%d... ", moveNumber)
+		}
+		sb.WriteString(p.san + " ")
+
+		if !whiteToMove {
+			moveNumber++
+		}
+		whiteToMove = !whiteToMove
+	}
+
+	sb.WriteString(cg.segment.Outcome().String())
+	return sb.String()
+}
+
+// DecodeMove checks a move sent by a player, given by its squares and its algebraic notation.
+// Chess960 castles are sent as the king moving onto its own rook
+func (cg *chessGame) DecodeMove(s1 chess.Square, s2 chess.Square, notation string) (*pendingMove, error) {
+	if castle, ok, err := cg.decodeChess960Castle(s1, s2); ok {
+		return castle, err
+	}
+
+	move, err := chess.AlgebraicNotation{}.Decode(cg.segment.Position(), notation)
+	if err != nil {
+		return nil, err
+	}
+	if move.S1() != s1 || move.S2() != s2 {
+		return nil, errors.New("the move doesn't match its squares")
+	}
+	return cg.pendingFromMove(move), nil
+}
+
+// DecodeUCI checks a move given in UCI notation, with Chess960 castles written as king takes rook
+func (cg *chessGame) DecodeUCI(uci string) (*pendingMove, error) {
+	if len(uci) >= 4 {
+		s1 := convertSquare(uci[0:2])
+		s2 := convertSquare(uci[2:4])
+		if s1 != nil && s2 != nil {
+			if castle, ok, err := cg.decodeChess960Castle(*s1, *s2); ok {
+				return castle, err
+			}
+		}
+	}
+
+	move, err := chess.UCINotation{}.Decode(cg.segment.Position(), uci)
+	if err != nil {
+		return nil, err
+	}
+	return cg.pendingFromMove(move), nil
+}
+
+func (cg *chessGame) pendingFromMove(move *chess.Move) *pendingMove {
+	return &pendingMove{
+		san:  chess.AlgebraicNotation{}.Encode(cg.segment.Position(), move),
+		uci:  chess.UCINotation{}.Encode(cg.segment.Position(), move),
+		s1:   move.S1(),
+		s2:   move.S2(),
+		move: move,
+	}
+}
+
+// Play plays a move returned by DecodeMove or DecodeUCI
+func (cg *chessGame) Play(pending *pendingMove) error {
+	piece := cg.segment.Position().Board().Piece(pending.s1)
+	if pending.move == nil {
+		fenOption, err := chess.FEN(pending.castleFEN)
+		if err != nil {
+			return err
+		}
+		cg.segment = chess.NewGame(fenOption)
+	} else {
+		err := cg.segment.Move(pending.move, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if piece.Type() == chess.King {
+		cg.dropCastlingRights(piece.Color())
+	}
+
+	delete(cg.castling, pending.s1)
+	delete(cg.castling, pending.s2)
+	cg.plies = append(cg.plies, ply{
+		san: pending.san,
+		uci: pending.uci,
+		s1:  pending.s1,
+		s2:  pending.s2,
+	})
+
+	if cg.variant == VariantStandard {
+		if opening := openings.Lookup(cg.FEN()); opening != nil {
+			cg.opening = opening
+		}
+	}
+	return nil
+}
+
+func (cg *chessGame) dropCastlingRights(color chess.Color) {
+	for rook := range cg.castling {
+		if rook.Rank() == backRank(color) {
+			delete(cg.castling, rook)
+		}
+	}
+}
+
+// WithoutLastPlies replays the game from its initial position, leaving out the last plies
+func (cg *chessGame) WithoutLastPlies(plies int) (*chessGame, error) {
+	if plies > len(cg.plies) {
+		return nil, errors.New("not enough moves to take back")
+	}
+
+	newGame, err := newChessGame(cg.variant, cg.initialFEN)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range cg.plies[:len(cg.plies)-plies] {
+		pending, err := newGame.DecodeUCI(p.uci)
+		if err != nil {
+			return nil, err
+		}
+		if err := newGame.Play(pending); err != nil {
+			return nil, err
+		}
+	}
+	return newGame, nil
+}
+
+func backRank(color chess.Color) chess.Rank {
+	if color == chess.White {
+		return chess.Rank1
+	}
+	return chess.Rank8
+}
+
+// decodeChess960Castle recognizes a Chess960 castle, the king moving onto one of its rooks that may
+// still castle. ok is false if the move is not a castle; otherwise err says whether it's legal.
+// Like in standard chess the king ends on the g or c file and the rook next to it, on f or d
+func (cg *chessGame) decodeChess960Castle(king chess.Square, rook chess.Square) (*pendingMove, bool, error) {
+	if cg.variant != VariantChess960 || !cg.castling[rook] {
+		return nil, false, nil
+	}
+
+	pos := cg.segment.Position()
+	color := pos.Turn()
+	pieces := pos.Board().SquareMap()
+	if pieces[king] != chess.NewPiece(chess.King, color) || pieces[rook] != chess.NewPiece(chess.Rook, color) {
+		return nil, false, nil
+	}
+
+	rank := backRank(color)
+	kingSide := rook.File() > king.File()
+	kingTo, rookTo := chess.NewSquare(chess.FileC, rank), chess.NewSquare(chess.FileD, rank)
+	san := "O-O-O"
+	if kingSide {
+		kingTo, rookTo = chess.NewSquare(chess.FileG, rank), chess.NewSquare(chess.FileF, rank)
+		san = "O-O"
+	}
+
+	// Every square the king and the rook go through must be empty, but for themselves
+	lowest := min(king.File(), rook.File(), kingTo.File(), rookTo.File())
+	highest := max(king.File(), rook.File(), kingTo.File(), rookTo.File())
+	for file := lowest; file <= highest; file++ {
+		sq := chess.NewSquare(file, rank)
+		if sq != king && sq != rook && pieces[sq] != chess.NoPiece {
+			return nil, true, errors.New("castling path is blocked")
+		}
+	}
+
+	// The king can't castle out of, through or into check
+	delete(pieces, king)
+	delete(pieces, rook)
+	step := chess.File(1)
+	if kingTo.File() < king.File() {
+		step = -1
+	}
+	for file := king.File(); ; file += step {
+		if isAttacked(pieces, chess.NewSquare(file, rank), color.Other()) {
+			return nil, true, errors.New("the king can't castle through check")
+		}
+		if file == kingTo.File() {
+			break
+		}
+	}
+
+	pieces[kingTo] = chess.NewPiece(chess.King, color)
+	pieces[rookTo] = chess.NewPiece(chess.Rook, color)
+
+	fields := strings.Fields(pos.String())
+	moveNumber, _ := strconv.Atoi(fields[5])
+	turn := "b"
+	if color == chess.Black {
+		turn = "w"
+		moveNumber++
+	}
+	castleFEN := fmt.Sprintf("%s %s - - %d %d", chess.NewBoard(pieces).String(), turn, pos.HalfMoveClock()+1, moveNumber)
+
+	fenOption, err := chess.FEN(castleFEN)
+	if err != nil {
+		return nil, true, err
+	}
+	next := chess.NewGame(fenOption)
+	if next.Method() == chess.Checkmate {
+		san += "#"
+	} else if isAttacked(pieces, kingSquare(next.Position().Board(), color.Other()), color) {
+		san += "+"
+	}
+
+	return &pendingMove{
+		san:       san,
+		uci:       king.String() + rook.String(),
+		s1:        king,
+		s2:        rook,
+		castleFEN: castleFEN,
+	}, true, nil
+}
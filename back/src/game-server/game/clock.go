@@ -0,0 +1,97 @@
+package game
+
+import (
+	"time"
+
+	"github.com/corentings/chess/v2"
+)
+
+type TimeControl struct {
+	Base      time.Duration
+	Increment time.Duration // Fischer increment, added to the mover's clock after every move
+	Delay     time.Duration // Bronstein delay, refunds up to Delay of the time spent on every move
+}
+
+type Clock struct {
+	control        TimeControl
+	whiteRemaining time.Duration
+	blackRemaining time.Duration
+	running        chess.Color
+	turnStartedAt  time.Time
+}
+
+func NewClock(control TimeControl) *Clock {
+	return &Clock{
+		control:        control,
+		whiteRemaining: control.Base,
+		blackRemaining: control.Base,
+		running:        chess.NoColor,
+	}
+}
+
+func (c *Clock) remainingPtr(color chess.Color) *time.Duration {
+	if color == chess.White {
+		return &c.whiteRemaining
+	}
+	return &c.blackRemaining
+}
+
+// Restore sets the time left for each side, used when resuming a game stored in the database
+func (c *Clock) Restore(whiteRemaining time.Duration, blackRemaining time.Duration) {
+	c.whiteRemaining = whiteRemaining
+	c.blackRemaining = blackRemaining
+}
+
+// Start makes the clock of the given color run from now on
+func (c *Clock) Start(color chess.Color, now time.Time) {
+	c.running = color
+	c.turnStartedAt = now
+}
+
+// Stop freezes both clocks, discounting the time used by the side that was running
+func (c *Clock) Stop(now time.Time) {
+	if c.running == chess.NoColor {
+		return
+	}
+	remaining := c.remainingPtr(c.running)
+	*remaining = max(0, *remaining-now.Sub(c.turnStartedAt))
+	c.running = chess.NoColor
+}
+
+// Remaining returns how much time the given color has left at the instant now
+func (c *Clock) Remaining(color chess.Color, now time.Time) time.Duration {
+	remaining := *c.remainingPtr(color)
+	if color == c.running {
+		remaining -= now.Sub(c.turnStartedAt)
+	}
+	return max(0, remaining)
+}
+
+// Running returns the color whose clock is currently ticking (chess.NoColor if stopped)
+func (c *Clock) Running() chess.Color {
+	return c.running
+}
+
+// Punch is called after the running side moves: it applies the delay and increment
+// to the mover's clock and starts the opponent's one
+func (c *Clock) Punch(now time.Time) {
+	if c.running == chess.NoColor {
+		return
+	}
+
+	elapsed := now.Sub(c.turnStartedAt)
+	remaining := c.remainingPtr(c.running)
+	*remaining = max(0, *remaining-elapsed) + min(elapsed, c.control.Delay) + c.control.Increment
+
+	c.Start(c.running.Other(), now)
+}
+
+func (c *Clock) State(now time.Time) ClockState {
+	return ClockState{
+		WhiteTimeMs: c.Remaining(chess.White, now).Milliseconds(),
+		BlackTimeMs: c.Remaining(chess.Black, now).Milliseconds(),
+		Running:     colorName(c.running),
+		IncrementMs: c.control.Increment.Milliseconds(),
+		DelayMs:     c.control.Delay.Milliseconds(),
+	}
+}
@@ -33,38 +33,82 @@ func (status GameStatus) String() string {
 	return ""
 }
 
+type disconnection struct {
+	timer *time.Timer
+	// The reconnection window is over and the opponent may claim the win
+	expired bool
+}
+
 type Game struct {
-	ID          uuid.UUID
-	WhitePlayer *Player
-	BlackPlayer *Player
-	Spectators  map[uuid.UUID]*Player
-	game        *chess.Game
-	mutex       sync.RWMutex
-	lastMoveS1  *chess.Square
-	lastMoveS2  *chess.Square
-	Winner      string
-	Status      GameStatus
-	whiteReady  bool
-	blackReady  bool
-	StartedAt   time.Time
-}
-
-func NewGame(id uuid.UUID, whitePlayer *Player, blackPlayer *Player) *Game {
-	return &Game{
-		ID:          id,
-		WhitePlayer: whitePlayer,
-		BlackPlayer: blackPlayer,
-		game:        chess.NewGame(),
-		mutex:       sync.RWMutex{},
-		lastMoveS1:  nil,
-		lastMoveS2:  nil,
-		Spectators:  make(map[uuid.UUID]*Player),
-		Winner:      "",
-		Status:      WaitingPlayers,
-		whiteReady:  false,
-		blackReady:  false,
-		StartedAt:   time.Now(),
+	ID             uuid.UUID
+	WhitePlayer    *Player
+	BlackPlayer    *Player
+	Spectators     map[uuid.UUID]*Player
+	game           *chessGame
+	mutex          sync.RWMutex
+	lastMoveS1     *chess.Square
+	lastMoveS2     *chess.Square
+	Winner         string
+	Status         GameStatus
+	Rated          bool
+	whiteReady     bool
+	blackReady     bool
+	StartedAt      time.Time
+	clock          *Clock
+	flagTimer      *time.Timer
+	abortTimer     *time.Timer
+	disconnections map[chess.Color]*disconnection
+	drawOffer      chess.Color
+	takeback       chess.Color
+	unlisted       map[chess.Color]bool
+	spectatorDelay time.Duration
+	feed           *spectatorFeed
+	writer         *gameWriter
+	chatSent       map[uuid.UUID][]time.Time
+	muted          map[chess.Color]bool
+	rematch        *rematchOffer
+	closeDue       bool // The room was due to close while a rematch offer was pending
+	closed         bool
+	whiteRating    *float64
+	blackRating    *float64
+	gm             *GameManager
+}
+
+// NewGame creates a game of the given variant, starting from initialFEN
+func NewGame(gm *GameManager, id uuid.UUID, whitePlayer *Player, blackPlayer *Player, timeControl TimeControl, rated bool, variant string, initialFEN string) (*Game, error) {
+	chessGame, err := newChessGame(variant, initialFEN)
+	if err != nil {
+		return nil, err
 	}
+
+	return &Game{
+		ID:             id,
+		WhitePlayer:    whitePlayer,
+		BlackPlayer:    blackPlayer,
+		game:           chessGame,
+		mutex:          sync.RWMutex{},
+		lastMoveS1:     nil,
+		lastMoveS2:     nil,
+		Spectators:     make(map[uuid.UUID]*Player),
+		Winner:         "",
+		Status:         WaitingPlayers,
+		Rated:          rated,
+		whiteReady:     false,
+		blackReady:     false,
+		StartedAt:      time.Now(),
+		clock:          NewClock(timeControl),
+		flagTimer:      nil,
+		abortTimer:     nil,
+		disconnections: make(map[chess.Color]*disconnection),
+		drawOffer:      chess.NoColor,
+		takeback:       chess.NoColor,
+		unlisted:       make(map[chess.Color]bool),
+		feed:           &spectatorFeed{},
+		writer:         &gameWriter{},
+		chatSent:       make(map[uuid.UUID][]time.Time),
+		muted:          make(map[chess.Color]bool),
+		gm:             gm,
+	}, nil
 }
 
 func (g *Game) AddPlayer(player *Player) {
@@ -85,20 +129,40 @@ func (g *Game) AddPlayer(player *Player) {
 		g.blackReady = true
 		opponent = g.WhitePlayer
 	} else {
-		g.Spectators[player.ID] = player
-		color = chess.NoColor
+		// Anyone else who sends init only watches the game
+		g.addSpectatorNoLock(player)
+		return
 	}
 
-	s1 := ""
-	if g.lastMoveS1 != nil {
-		s1 = g.lastMoveS1.String()
-	}
-	s2 := ""
-	if g.lastMoveS2 != nil {
-		s2 = g.lastMoveS2.String()
+	player.SendMessage(newWelcomeMessage(g.welcomeContextNoLock()))
+
+	g.playerReconnectedNoLock(player, color)
+
+	if g.whiteReady && g.blackReady && g.Status == WaitingPlayers {
+		g.Status = GameOngoing
+
+		// Games resumed from the database may not be at their start
+		turn := g.game.Position().Turn()
+		g.clock.Start(turn, time.Now())
+		g.scheduleFlagNoLock()
+		if !g.hasMovedNoLock(turn) {
+			g.scheduleAbortNoLock(g.gm.config.FirstMoveTimeout, "no first move")
+		}
+		startedMsg := Message{
+			Type: "game_started",
+			Data: "",
+		}
+		player.SendMessage(startedMsg)
+		opponent.SendMessage(startedMsg)
+		g.broadcastToSpectatorsNoLock(startedMsg)
 	}
+}
 
-	welcomeMessage := WelcomeContextMessage{
+// welcomeContextNoLock describes the room and the live position of the game, for whoever joins it
+func (g *Game) welcomeContextNoLock() WelcomeContextMessage {
+	s1, s2 := g.lastMoveStringsNoLock()
+
+	return WelcomeContextMessage{
 		RoomID:          g.ID.String(),
 		Player1ID:       g.WhitePlayer.ID.String(),
 		Player1Username: g.WhitePlayer.Username,
@@ -110,32 +174,25 @@ func (g *Game) AddPlayer(player *Player) {
 		LastMoveS2:      s2,
 		GameStatus:      g.Status.String(),
 		Winner:          g.Winner,
+		Clock:           g.clock.State(time.Now()),
+		Rated:           g.Rated,
+		Variant:         g.game.variant,
+		InitialFEN:      g.game.initialFEN,
+		Opening:         g.game.opening,
+		Spectators:      len(g.Spectators),
+		Unlisted:        g.isUnlistedNoLock(),
 	}
+}
 
-	jsonData, err := json.Marshal(welcomeMessage)
+func newWelcomeMessage(welcome WelcomeContextMessage) Message {
+	jsonData, err := json.Marshal(welcome)
 	if err != nil {
 		panic(err)
 	}
 
-	res := player.SendMessage(Message{
+	return Message{
 		Type: "welcome",
 		Data: string(jsonData),
-	})
-
-	if !res && color == chess.NoColor {
-		player.mutex.Lock()
-		delete(g.Spectators, player.ID)
-		player.mutex.Unlock()
-	}
-
-	if color != chess.NoColor && g.whiteReady && g.blackReady && g.Status == WaitingPlayers {
-		g.Status = GameOngoing
-		startedMsg := Message{
-			Type: "game_started",
-			Data: "",
-		}
-		player.SendMessage(startedMsg)
-		opponent.SendMessage(startedMsg)
 	}
 }
 
@@ -166,31 +223,56 @@ func (g *Game) SendMove(player *Player, message PlayerMovedMessage) bool {
 		return false
 	}
 
-	turn := g.game.CurrentPosition().Turn()
+	turn := g.game.Position().Turn()
 	if turn != color {
 		return false
 	}
 
-	for _, move := range g.game.ValidMoves() {
-		if move.S1() != *s1 || move.S2() != *s2 {
-			continue
-		}
-		move.NAG()
-	}
-
-	move, err := chess.AlgebraicNotation{}.Decode(g.game.Position(), message.MoveNotation)
+	move, err := g.game.DecodeMove(*s1, *s2, message.MoveNotation)
 	if err != nil {
 		return false
 	}
-	if move.S1() != *s1 || move.S2() != *s2 {
-		return false
+
+	// The move arrived after the flag fell, but before the timer went off
+	now := time.Now()
+	if g.clock.Remaining(color, now) <= 0 {
+		g.flagNoLock(color)
+		return true
 	}
 
-	err = g.game.Move(move, nil)
+	previousOpening := g.game.opening
+	err = g.game.Play(move)
 	if err != nil {
 		return false
 	}
 
+	// A pending draw offer expires as soon as the player who made it moves
+	if g.drawOffer == color {
+		g.drawOffer = chess.NoColor
+		opponent.SendMessage(Message{
+			Type: "draw_offer_expired",
+			Data: "",
+		})
+	}
+
+	// Moving means the pending takeback request was not accepted
+	if g.takeback != chess.NoColor {
+		g.takeback = chess.NoColor
+		expiredMsg := Message{
+			Type: "takeback_expired",
+			Data: "",
+		}
+		player.SendMessage(expiredMsg)
+		opponent.SendMessage(expiredMsg)
+	}
+
+	g.lastMoveS1 = s1
+	g.lastMoveS2 = s2
+	g.clock.Punch(now)
+	clockState := g.clock.State(now)
+	message.Clock = &clockState
+	g.saveMoveNoLock(move.san, move.uci, now)
+
 	jsonData, err := json.Marshal(message)
 	if err != nil {
 		panic(err)
@@ -201,142 +283,445 @@ func (g *Game) SendMove(player *Player, message PlayerMovedMessage) bool {
 		Data: string(jsonData),
 	}
 
-	outcome := g.game.Outcome()
-	if outcome != chess.NoOutcome {
-		result := ""
-		switch outcome {
-		case chess.Draw:
-			g.Winner = "draw"
-			result = "draw"
-		case chess.BlackWon:
-			g.Winner = g.BlackPlayer.ID.String()
-			result = "black"
-		case chess.WhiteWon:
-			g.Winner = g.WhitePlayer.ID.String()
-			result = "white"
-		case chess.UnknownOutcome:
-			fmt.Println(g.game.String())
-			fmt.Println(g.game.FEN())
-			panic("We got an unknown outcome")
+	// The mover already knows the move, it only needs the updated clocks
+	clockData, err := json.Marshal(clockState)
+	if err != nil {
+		panic(err)
+	}
+	player.SendMessage(Message{
+		Type: "clock",
+		Data: string(clockData),
+	})
+	opponent.SendMessage(moveMessage)
+	g.broadcastToSpectatorsNoLock(moveMessage)
+
+	// Players and spectators are told when the game reaches a position with a new opening name
+	if g.game.opening != previousOpening {
+		openingData, err := json.Marshal(g.game.opening)
+		if err != nil {
+			panic(err)
+		}
+		openingMessage := Message{
+			Type: "opening",
+			Data: string(openingData),
 		}
+		player.SendMessage(openingMessage)
+		opponent.SendMessage(openingMessage)
+		g.broadcastToSpectatorsNoLock(openingMessage)
+	}
 
-		gameEndMessage := GameEndedMessage{
-			Winner: g.Winner,
+	// Each side has a deadline for its first move, the game is aborted otherwise
+	switch g.game.Plies() {
+	case 1:
+		g.scheduleAbortNoLock(g.gm.config.FirstMoveTimeout, "no first move")
+	case 2:
+		if g.abortTimer != nil {
+			g.abortTimer.Stop()
 		}
-		jsonData, err := json.Marshal(gameEndMessage)
+	}
+
+	outcome := g.game.Outcome()
+	if outcome == chess.NoOutcome {
+		g.saveProgressNoLock(now)
+	} else {
+		result, err := outcomeResult(outcome)
 		if err != nil {
-			panic(err)
+			// The game can't go on, but it mustn't take the server and the other rooms down with it
+			fmt.Printf("Failed to end game %s at %s: %v\n", g.ID, g.game.FEN(), err)
+			g.endGameNoLock("aborted", "unknown outcome")
+			return true
 		}
-		winMsg := Message{
-			Type: "game_ended",
-			Data: string(jsonData),
+
+		g.endGameNoLock(result, g.game.Method().String())
+		return true
+	}
+
+	g.scheduleFlagNoLock()
+	return true
+}
+
+// saveMoveNoLock appends the last move, with the position and clocks after it, to the move history of the game
+func (g *Game) saveMoveNoLock(san string, uci string, now time.Time) {
+	move := &models.GameMove{
+		GameID:      g.ID,
+		Ply:         g.game.Plies(),
+		SAN:         san,
+		UCI:         uci,
+		FEN:         g.game.FEN(),
+		PlayedAt:    now,
+		WhiteTimeMs: g.clock.Remaining(chess.White, now).Milliseconds(),
+		BlackTimeMs: g.clock.Remaining(chess.Black, now).Milliseconds(),
+	}
+	g.queueWrite(func(ctx context.Context) {
+		err := g.gm.gameRepo.AddGameMove(ctx, move)
+		if err != nil {
+			fmt.Printf("Failed to save move of game %s: %v\n", g.ID, err)
 		}
+	})
+}
 
-		player.gm.gameRepo.UpdateGame(context.Background(), &models.Game{
-			ID:           g.ID,
-			WhiteID:      g.WhitePlayer.ID,
-			BlackID:      g.BlackPlayer.ID,
-			PGN:          g.game.String(),
-			LastFEN:      g.game.FEN(),
-			Result:       result,
-			ResultReason: g.game.Method().String(),
-			Status:       "ended",
-			StartedAt:    g.StartedAt,
-			EndedAt:      time.Now(),
-		})
+// saveProgressNoLock stores the moves and clocks so the game can be resumed if the server restarts
+func (g *Game) saveProgressNoLock(now time.Time) {
+	pgn, fen := g.game.String(), g.game.FEN()
+	whiteTimeMs, blackTimeMs := g.clock.Remaining(chess.White, now).Milliseconds(), g.clock.Remaining(chess.Black, now).Milliseconds()
+	g.queueWrite(func(ctx context.Context) {
+		err := g.gm.gameRepo.SaveGameProgress(ctx, g.ID, pgn, fen, whiteTimeMs, blackTimeMs)
+		if err != nil {
+			fmt.Printf("Failed to save progress of game %s: %v\n", g.ID, err)
+		}
+	})
+}
 
-		opponent.SendMessage(moveMessage)
-		opponent.SendMessage(winMsg)
-		player.SendMessage(winMsg)
+func (g *Game) Resign(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status != GameOngoing {
+		return false
+	}
 
-		for specID, spec := range g.Spectators {
-			ok := false
-			if spec != nil {
-				ok = spec.SendMessage(moveMessage)
-				ok = ok && spec.SendMessage(winMsg)
-			}
+	var opponentColor string
+	switch player.ID {
+	case g.WhitePlayer.ID:
+		opponentColor = "black"
+		g.game.Resign(chess.White)
+	case g.BlackPlayer.ID:
+		opponentColor = "white"
+		g.game.Resign(chess.Black)
+	default:
+		return false
+	}
+
+	g.endGameNoLock(opponentColor, "Resignation")
+	return true
+}
+
+// restoreLastMoveNoLock sets lastMoveS1/lastMoveS2 from the last move of the main line
+func (g *Game) restoreLastMoveNoLock() {
+	g.lastMoveS1 = nil
+	g.lastMoveS2 = nil
+	if s1, s2, ok := g.game.LastMove(); ok {
+		g.lastMoveS1 = &s1
+		g.lastMoveS2 = &s2
+	}
+}
 
-			if !ok {
-				delete(g.Spectators, specID)
+func (g *Game) lastMoveStringsNoLock() (string, string) {
+	s1 := ""
+	if g.lastMoveS1 != nil {
+		s1 = g.lastMoveS1.String()
+	}
+	s2 := ""
+	if g.lastMoveS2 != nil {
+		s2 = g.lastMoveS2.String()
+	}
+	return s1, s2
+}
+
+// hasMovedNoLock reports whether the side played a move yet. The side to move in the initial position plays
+// the first ply, which is black in some games played from a position
+func (g *Game) hasMovedNoLock(color chess.Color) bool {
+	plies := g.game.Plies()
+	if color == g.game.FirstToMove() {
+		return plies >= 1
+	}
+	return plies >= 2
+}
+
+// scheduleAbortNoLock (re)arms the timer that aborts the game if nobody moves
+// (or, while waiting for players, if someone doesn't show up) before the timeout
+func (g *Game) scheduleAbortNoLock(timeout time.Duration, reason string) {
+	if g.abortTimer != nil {
+		g.abortTimer.Stop()
+	}
+
+	status := g.Status
+	plies := g.game.Plies()
+	g.abortTimer = time.AfterFunc(timeout, func() {
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+
+		// The game started, ended or someone moved since the timer was armed
+		if g.Status != status || g.game.Plies() != plies {
+			return
+		}
+
+		// A resumed game in which only one of the players came back is won by that player
+		bothMoved := g.hasMovedNoLock(chess.White) && g.hasMovedNoLock(chess.Black)
+		if status == WaitingPlayers && bothMoved && g.whiteReady != g.blackReady {
+			winner := chess.Black
+			if g.whiteReady {
+				winner = chess.White
 			}
+			g.endGameNoLock(colorName(winner), "abandonment")
+			return
 		}
+		g.endGameNoLock("aborted", reason)
+	})
+}
 
-		g.Status = GameEnded
+// Abort ends the game without a result. A player can only abort before making its first move
+func (g *Game) Abort(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status == GameEnded {
+		return false
+	}
 
-		go func() {
-			time.Sleep(time.Second)
-			g.mutex.Lock()
+	color, _ := g.playerNoLock(player)
+	if color == chess.NoColor {
+		return false
+	}
 
-			gameEndedMessage := Message{
-				Type: "quit",
-				Data: "Game ended",
-			}
+	if g.hasMovedNoLock(color) {
+		player.SendMessage(Message{
+			Type: "abort_rejected",
+			Data: "",
+		})
+		return true
+	}
 
-			streamGameEndedMsg := matchmaking_grpc.GameEndedEventMsg{
-				Pl1: player.ID.String(),
-				Pl2: opponent.ID.String(),
-			}
+	g.endGameNoLock("aborted", "aborted by player")
+	return true
+}
 
-			player.gm.StreamChannel <- streamGameEndedMsg
+// playerNoLock returns the color and the opponent of a player, or chess.NoColor if it isn't playing this game
+func (g *Game) playerNoLock(player *Player) (chess.Color, *Player) {
+	switch player.ID {
+	case g.WhitePlayer.ID:
+		return chess.White, g.BlackPlayer
+	case g.BlackPlayer.ID:
+		return chess.Black, g.WhitePlayer
+	}
+	return chess.NoColor, nil
+}
 
-			player.SendMessage(gameEndedMessage)
-			opponent.SendMessage(gameEndedMessage)
-			for _, spec := range g.Spectators {
-				if spec != nil {
-					spec.SendMessage(gameEndedMessage)
-				}
-			}
-			toDeleteId := g.ID
-			g.mutex.Unlock()
-
-			player.gm.mutex.Lock()
-			delete(player.gm.games, toDeleteId)
-			player.gm.mutex.Unlock()
-			//TODO: save game result in database
-		}()
+func (g *Game) OfferDraw(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status != GameOngoing {
+		return false
+	}
+
+	color, opponent := g.playerNoLock(player)
+	if color == chess.NoColor {
+		return false
+	}
+
+	// Both players want a draw
+	if g.drawOffer == color.Other() {
+		g.game.Draw(chess.DrawOffer)
+		g.endGameNoLock("draw", "agreement")
 		return true
 	}
 
-	opponent.SendMessage(moveMessage)
+	if g.drawOffer == color {
+		return true
+	}
+	g.drawOffer = color
+
+	jsonData, err := json.Marshal(DrawOfferMessage{
+		OfferedBy: player.ID.String(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	opponent.SendMessage(Message{
+		Type: "draw_offered",
+		Data: string(jsonData),
+	})
+	return true
+}
+
+func (g *Game) AcceptDraw(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status != GameOngoing {
+		return false
+	}
+
+	color, _ := g.playerNoLock(player)
+	if color == chess.NoColor {
+		return false
+	}
+
+	// The offer may have expired right before the answer arrived
+	if g.drawOffer != color.Other() {
+		return true
+	}
+
+	g.game.Draw(chess.DrawOffer)
+	g.endGameNoLock("draw", "agreement")
+	return true
+}
+
+func (g *Game) DeclineDraw(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status != GameOngoing {
+		return false
+	}
+
+	color, opponent := g.playerNoLock(player)
+	if color == chess.NoColor {
+		return false
+	}
+
+	if g.drawOffer != color.Other() {
+		return true
+	}
+
+	g.drawOffer = chess.NoColor
+	opponent.SendMessage(Message{
+		Type: "draw_declined",
+		Data: "",
+	})
+	return true
+}
+
+// ClaimDraw ends the game as a draw if the current position has been repeated
+// three times or if no capture or pawn move happened in the last fifty moves
+func (g *Game) ClaimDraw(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status != GameOngoing {
+		return false
+	}
+
+	color, _ := g.playerNoLock(player)
+	if color == chess.NoColor {
+		return false
+	}
+
+	for _, method := range g.game.EligibleDraws() {
+		switch method {
+		case chess.ThreefoldRepetition:
+			g.game.Draw(method)
+			g.endGameNoLock("draw", "threefold repetition claimed")
+			return true
+		case chess.FiftyMoveRule:
+			g.game.Draw(method)
+			g.endGameNoLock("draw", "fifty-move rule claimed")
+			return true
+		}
+	}
+
+	player.SendMessage(Message{
+		Type: "draw_claim_rejected",
+		Data: "",
+	})
+	return true
+}
+
+// scheduleFlagNoLock (re)arms the timer that ends the game when the running side runs out of time
+func (g *Game) scheduleFlagNoLock() {
+	if g.flagTimer != nil {
+		g.flagTimer.Stop()
+	}
+
+	color := g.clock.Running()
+	if color == chess.NoColor {
+		return
+	}
+
+	g.flagTimer = time.AfterFunc(g.clock.Remaining(color, time.Now()), func() {
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+
+		if g.Status != GameOngoing || g.clock.Running() != color {
+			return
+		}
+
+		// The timer may fire slightly early, or the clock may have been punched meanwhile
+		if g.clock.Remaining(color, time.Now()) > 0 {
+			g.scheduleFlagNoLock()
+			return
+		}
+		g.flagNoLock(color)
+	})
+}
+
+// flagNoLock ends the game because the given color ran out of time.
+// If the opponent can't possibly mate, the game is scored as a draw.
+func (g *Game) flagNoLock(color chess.Color) {
+	g.clock.Stop(time.Now())
+
+	if !g.hasMovedNoLock(color) {
+		g.endGameNoLock("aborted", "no first move")
+		return
+	}
+
+	opponentColor := color.Other()
+	if !hasMatingMaterial(g.game.Position().Board(), opponentColor) {
+		g.endGameNoLock("draw", "timeout vs insufficient material")
+		return
+	}
+	g.endGameNoLock(colorName(opponentColor), "timeout")
+}
+
+// broadcastToSpectatorsNoLock sends a message to the spectators, through the delayed feed if the game has one
+func (g *Game) broadcastToSpectatorsNoLock(message Message) {
+	if g.spectatorDelay > 0 && g.queueForSpectatorsNoLock(message) {
+		return
+	}
+	g.sendToSpectatorsNoLock(message)
+}
+
+func (g *Game) sendToSpectatorsNoLock(message Message) {
 	for specID, spec := range g.Spectators {
 		ok := false
 		if spec != nil {
-			ok = spec.SendMessage(moveMessage)
+			ok = spec.SendMessage(message)
 		}
 		if !ok {
 			delete(g.Spectators, specID)
 		}
 	}
+}
 
-	return true
+// endGameNoLock stores the final result of the game and notifies everyone in the room, which is closed
+// once the rematch window is over. result is either "white", "black", "draw" or "aborted"
+// outcomeResult returns the result a game that reached the outcome is stored with
+func outcomeResult(outcome chess.Outcome) (string, error) {
+	switch outcome {
+	case chess.Draw:
+		return "draw", nil
+	case chess.BlackWon:
+		return "black", nil
+	case chess.WhiteWon:
+		return "white", nil
+	}
+	return "", fmt.Errorf("unexpected outcome %q", outcome)
 }
 
-func (g *Game) Resign(player *Player) bool {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
-	if g.Status != GameOngoing {
-		return false
+func (g *Game) endGameNoLock(result string, reason string) {
+	now := time.Now()
+	g.Status = GameEnded
+	g.clock.Stop(now)
+	if g.flagTimer != nil {
+		g.flagTimer.Stop()
 	}
 
-	var opponentColor string
-	var opponent *Player
-	switch player.ID {
-	case g.WhitePlayer.ID:
-		opponent = g.BlackPlayer
-		opponentColor = "black"
-		g.game.Resign(chess.White)
-	case g.BlackPlayer.ID:
-		opponent = g.WhitePlayer
-		opponentColor = "white"
-		g.game.Resign(chess.Black)
-	default:
-		return false
+	if g.abortTimer != nil {
+		g.abortTimer.Stop()
+	}
+	for _, d := range g.disconnections {
+		d.timer.Stop()
 	}
 
-	g.Winner = opponent.ID.String()
+	switch result {
+	case "white":
+		g.Winner = g.WhitePlayer.ID.String()
+	case "black":
+		g.Winner = g.BlackPlayer.ID.String()
+	case "aborted":
+		g.Winner = ""
+	default:
+		g.Winner = "draw"
+	}
 
 	gameEndMessage := GameEndedMessage{
 		Winner: g.Winner,
+		Reason: reason,
 	}
 	jsonData, err := json.Marshal(gameEndMessage)
 	if err != nil {
@@ -347,64 +732,340 @@ func (g *Game) Resign(player *Player) bool {
 		Data: string(jsonData),
 	}
 
-	player.gm.gameRepo.UpdateGame(context.Background(), &models.Game{
+	eco, openingName := "", ""
+	if g.game.opening != nil {
+		eco, openingName = g.game.opening.ECO, g.game.opening.Name
+	}
+	ended := &models.Game{
 		ID:           g.ID,
 		WhiteID:      g.WhitePlayer.ID,
 		BlackID:      g.BlackPlayer.ID,
 		PGN:          g.game.String(),
 		LastFEN:      g.game.FEN(),
-		Result:       opponentColor,
-		ResultReason: "Resignation",
+		Result:       result,
+		ResultReason: reason,
 		Status:       "ended",
 		StartedAt:    g.StartedAt,
-		EndedAt:      time.Now(),
+		EndedAt:      now,
+		WhiteTimeMs:  g.clock.Remaining(chess.White, now).Milliseconds(),
+		BlackTimeMs:  g.clock.Remaining(chess.Black, now).Milliseconds(),
+		ECO:          eco,
+		Opening:      openingName,
+	}
+	endedEvent := &matchmaking_grpc.GameEndedEventMsg{
+		Pl1:    g.WhitePlayer.ID.String(),
+		Pl2:    g.BlackPlayer.ID.String(),
+		RoomId: g.ID.String(),
+		Result: result,
+		Event:  "game_ended",
+	}
+	// Queued after the moves of the game, so it's stored whole when it's marked as ended. The API hears
+	// about it once it's stored, and a slow stream holds up nothing but the writes of this game
+	g.queueWrite(func(ctx context.Context) {
+		err := g.gm.gameRepo.UpdateGame(ctx, ended)
+		if err != nil {
+			fmt.Printf("Failed to save the end of game %s: %v\n", g.ID, err)
+		}
+		g.gm.StreamChannel <- endedEvent
 	})
 
 	g.WhitePlayer.SendMessage(winMsg)
 	g.BlackPlayer.SendMessage(winMsg)
+	g.broadcastToSpectatorsNoLock(winMsg)
 
-	for specID, spec := range g.Spectators {
-		ok := false
-		if spec != nil {
-			ok = spec.SendMessage(winMsg)
-		}
-		if !ok {
-			delete(g.Spectators, specID)
-		}
+	// The room stays open for the players to offer a rematch
+	time.AfterFunc(max(time.Second, g.gm.config.RematchWindow), g.closeRoom)
+}
+
+// closeRoom sends everyone off and forgets the game, once it's over. It waits for a pending rematch offer to be answered
+func (g *Game) closeRoom() {
+	g.mutex.Lock()
+	if g.closed {
+		g.mutex.Unlock()
+		return
 	}
+	if g.rematch != nil {
+		g.closeDue = true
+		g.mutex.Unlock()
+		return
+	}
+	g.closed = true
 
-	g.Status = GameEnded
-	go func() {
-		time.Sleep(time.Second)
-		g.mutex.Lock()
+	gameEndedMessage := Message{
+		Type: "quit",
+		Data: "Game ended",
+	}
 
-		gameEndedMessage := Message{
-			Type: "quit",
-			Data: "Game ended",
-		}
+	// Delayed spectators are sent off once they have seen the end of the game
+	g.broadcastToSpectatorsNoLock(gameEndedMessage)
+	g.closeSpectatorFeed()
+	whitePlayer := g.WhitePlayer
+	blackPlayer := g.BlackPlayer
+	g.mutex.Unlock()
 
-		streamGameEndedMsg := matchmaking_grpc.GameEndedEventMsg{
-			Pl1: player.ID.String(),
-			Pl2: opponent.ID.String(),
+	// Players that already joined another room keep their connection
+	for _, player := range []*Player{whitePlayer, blackPlayer} {
+		player.mutex.Lock()
+		if player.OngoingGame == g {
+			player.SendMessageNoLock(gameEndedMessage)
 		}
+		player.mutex.Unlock()
+	}
 
-		player.gm.StreamChannel <- streamGameEndedMsg
+	g.gm.mutex.Lock()
+	delete(g.gm.games, g.ID)
+	g.gm.mutex.Unlock()
+}
 
-		player.SendMessage(gameEndedMessage)
-		opponent.SendMessage(gameEndedMessage)
-		for _, spec := range g.Spectators {
-			if spec != nil {
-				spec.SendMessage(gameEndedMessage)
-			}
+// takebackPliesNoLock returns how many plies have to be undone so that it's the given color's turn
+// again, right before its last move. Zero means the color hasn't moved yet.
+func (g *Game) takebackPliesNoLock(color chess.Color) int {
+	plies := 1
+	if g.game.Position().Turn() == color {
+		plies = 2
+	}
+	if plies > g.game.Plies() {
+		return 0
+	}
+	return plies
+}
+
+// RequestTakeback asks the opponent to undo the last move of the player. Only casual games allow it
+func (g *Game) RequestTakeback(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status != GameOngoing {
+		return false
+	}
+
+	color, opponent := g.playerNoLock(player)
+	if color == chess.NoColor {
+		return false
+	}
+
+	if g.Rated || g.takeback != chess.NoColor || g.takebackPliesNoLock(color) == 0 {
+		player.SendMessage(Message{
+			Type: "takeback_declined",
+			Data: "",
+		})
+		return true
+	}
+	g.takeback = color
+
+	jsonData, err := json.Marshal(TakebackRequestMessage{
+		RequestedBy: player.ID.String(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	opponent.SendMessage(Message{
+		Type: "takeback_requested",
+		Data: string(jsonData),
+	})
+	return true
+}
+
+func (g *Game) AcceptTakeback(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status != GameOngoing {
+		return false
+	}
+
+	color, _ := g.playerNoLock(player)
+	if color == chess.NoColor {
+		return false
+	}
+
+	// The request may have expired right before the answer arrived
+	requester := color.Other()
+	if g.takeback != requester {
+		return true
+	}
+	g.takeback = chess.NoColor
+
+	newGame, err := g.game.WithoutLastPlies(g.takebackPliesNoLock(requester))
+	if err != nil {
+		fmt.Printf("Failed to take back move in game %s: %v\n", g.ID, err)
+		return true
+	}
+	g.game = newGame
+	g.drawOffer = chess.NoColor
+
+	g.restoreLastMoveNoLock()
+
+	now := time.Now()
+	g.clock.Stop(now)
+	g.clock.Start(g.game.Position().Turn(), now)
+	g.scheduleFlagNoLock()
+	// Taking back a first move gives that side its first move deadline again
+	if !g.hasMovedNoLock(chess.White) || !g.hasMovedNoLock(chess.Black) {
+		g.scheduleAbortNoLock(g.gm.config.FirstMoveTimeout, "no first move")
+	}
+	g.saveProgressNoLock(now)
+
+	plies := g.game.Plies()
+	g.queueWrite(func(ctx context.Context) {
+		err := g.gm.gameRepo.DeleteGameMovesAfter(ctx, g.ID, plies)
+		if err != nil {
+			fmt.Printf("Failed to delete taken back moves of game %s: %v\n", g.ID, err)
 		}
-		toDeleteId := g.ID
-		g.mutex.Unlock()
+	})
 
-		player.gm.mutex.Lock()
-		delete(player.gm.games, toDeleteId)
-		player.gm.mutex.Unlock()
-		//TODO: save game result in database
-	}()
+	s1, s2 := g.lastMoveStringsNoLock()
+	jsonData, err := json.Marshal(TakebackMessage{
+		GameFEN:    g.game.FEN(),
+		GamePGN:    g.game.String(),
+		LastMoveS1: s1,
+		LastMoveS2: s2,
+		Clock:      g.clock.State(now),
+		Opening:    g.game.opening,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	takebackMsg := Message{
+		Type: "takeback",
+		Data: string(jsonData),
+	}
+	g.WhitePlayer.SendMessage(takebackMsg)
+	g.BlackPlayer.SendMessage(takebackMsg)
+	g.broadcastToSpectatorsNoLock(takebackMsg)
+	return true
+}
+
+func (g *Game) DeclineTakeback(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status != GameOngoing {
+		return false
+	}
+
+	color, opponent := g.playerNoLock(player)
+	if color == chess.NoColor {
+		return false
+	}
+
+	if g.takeback != color.Other() {
+		return true
+	}
+
+	g.takeback = chess.NoColor
+	opponent.SendMessage(Message{
+		Type: "takeback_declined",
+		Data: "",
+	})
 	return true
+}
+
+func (g *Game) sendToOpponentAndSpectatorsNoLock(color chess.Color, message Message) {
+	if color == chess.White {
+		g.BlackPlayer.SendMessage(message)
+	} else {
+		g.WhitePlayer.SendMessage(message)
+	}
+	g.broadcastToSpectatorsNoLock(message)
+}
 
+// PlayerDisconnected starts the reconnection window of a player whose connection dropped.
+// Once it's over without the player coming back, its opponent can claim the win
+func (g *Game) PlayerDisconnected(player *Player) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status != GameOngoing {
+		return
+	}
+
+	color, _ := g.playerNoLock(player)
+	if color == chess.NoColor {
+		return
+	}
+
+	// The player may have reconnected before this got to run
+	if _, ok := g.disconnections[color]; ok || player.IsConnected() {
+		return
+	}
+
+	timeout := g.gm.config.ReconnectTimeout
+	jsonData, err := json.Marshal(DisconnectionMessage{
+		PlayerID:  player.ID.String(),
+		TimeoutMs: timeout.Milliseconds(),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	d := &disconnection{}
+	d.timer = time.AfterFunc(timeout, func() {
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+		if g.Status != GameOngoing || g.disconnections[color] != d {
+			return
+		}
+
+		d.expired = true
+		g.sendToOpponentAndSpectatorsNoLock(color, Message{
+			Type: "opponent_abandoned",
+			Data: string(jsonData),
+		})
+	})
+	g.disconnections[color] = d
+
+	g.sendToOpponentAndSpectatorsNoLock(color, Message{
+		Type: "opponent_disconnected",
+		Data: string(jsonData),
+	})
+}
+
+// playerReconnectedNoLock is called when a player that lost its connection joins the game again
+func (g *Game) playerReconnectedNoLock(player *Player, color chess.Color) {
+	d, ok := g.disconnections[color]
+	if !ok {
+		return
+	}
+	d.timer.Stop()
+	delete(g.disconnections, color)
+
+	if g.Status != GameOngoing {
+		return
+	}
+
+	jsonData, err := json.Marshal(DisconnectionMessage{
+		PlayerID:  player.ID.String(),
+		TimeoutMs: 0,
+	})
+	if err != nil {
+		panic(err)
+	}
+	g.sendToOpponentAndSpectatorsNoLock(color, Message{
+		Type: "opponent_reconnected",
+		Data: string(jsonData),
+	})
+}
+
+// ClaimAbandonment gives the win to the player if its opponent didn't reconnect in time
+func (g *Game) ClaimAbandonment(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status != GameOngoing {
+		return false
+	}
+
+	color, _ := g.playerNoLock(player)
+	if color == chess.NoColor {
+		return false
+	}
+
+	d, ok := g.disconnections[color.Other()]
+	if !ok || !d.expired {
+		player.SendMessage(Message{
+			Type: "claim_win_rejected",
+			Data: "",
+		})
+		return true
+	}
+
+	g.endGameNoLock(colorName(color), "abandonment")
+	return true
 }
@@ -2,33 +2,63 @@ package game
 
 import (
 	"context"
+	"database/models"
+	"database/ratings"
 	"database/repositories"
 	"errors"
+	"fmt"
+	"game-server/engine"
+	"math/rand/v2"
 	"proto-generated/matchmaking_grpc"
 	"sync"
 	"time"
+	"utils/uci"
 
 	"github.com/google/uuid"
 )
 
+// How many of the last games of each player are considered by the "balanced" color policy
+const recentGamesForColorBalance = 20
+
+type Config struct {
+	// Time control used for new rooms requested without one
+	DefaultTimeControl TimeControl
+	// Time both players have to join a new room before it's aborted
+	ArrivalTimeout time.Duration
+	// Time each player has to make its first move before the game is aborted
+	FirstMoveTimeout time.Duration
+	// Time a disconnected player has to come back before its opponent can claim the win
+	ReconnectTimeout time.Duration
+	// UCI engine the bots play with, nil to use the built-in engine
+	BotEngine uci.Engine
+	// How long after the players spectators see the game, for rooms requested without a delay of their own
+	SpectatorDelay time.Duration
+	// Time players have to offer a rematch once a game ends, and to answer an offer. The room closes after it
+	RematchWindow time.Duration
+}
+
 type GameManager struct {
 	players       map[uuid.UUID]*Player
 	games         map[uuid.UUID]*Game
 	mutex         sync.RWMutex
 	userRepo      *repositories.UserRepo
 	gameRepo      *repositories.GameRepo
-	StreamChannel (chan matchmaking_grpc.GameEndedEventMsg)
+	config        *Config
+	StreamChannel (chan *matchmaking_grpc.GameEndedEventMsg)
 }
 
-func NewGameManager(userRepo *repositories.UserRepo, gameRepo *repositories.GameRepo) *GameManager {
-	return &GameManager{
+func NewGameManager(userRepo *repositories.UserRepo, gameRepo *repositories.GameRepo, config *Config) *GameManager {
+	gm := &GameManager{
 		players:       map[uuid.UUID]*Player{},
 		games:         map[uuid.UUID]*Game{},
 		mutex:         sync.RWMutex{},
 		userRepo:      userRepo,
 		gameRepo:      gameRepo,
-		StreamChannel: make(chan matchmaking_grpc.GameEndedEventMsg, 100),
+		config:        config,
+		StreamChannel: make(chan *matchmaking_grpc.GameEndedEventMsg, 100),
 	}
+	gm.loadGamesInProgress()
+	return gm
 }
 
 func (gm *GameManager) getPlayerNoLock(id uuid.UUID) *Player {
@@ -64,7 +94,74 @@ func (gm *GameManager) getGame(id uuid.UUID) *Game {
 	return game
 }
 
-func (gm *GameManager) CreateNewGame(playerID1 uuid.UUID, playerID2 uuid.UUID) (*Game, error) {
+// assignColors decides who plays white according to the color policy of playerID1:
+// "white", "black", "random" or "balanced" (whoever played white more often recently gets black)
+func (gm *GameManager) assignColors(playerID1 uuid.UUID, playerID2 uuid.UUID, player1Color string) (uuid.UUID, uuid.UUID, error) {
+	switch player1Color {
+	case "white":
+		return playerID1, playerID2, nil
+	case "black":
+		return playerID2, playerID1, nil
+	case "random":
+	case "", "balanced":
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		balance1, err1 := gm.gameRepo.GetColorBalance(ctx, playerID1, recentGamesForColorBalance)
+		balance2, err2 := gm.gameRepo.GetColorBalance(ctx, playerID2, recentGamesForColorBalance)
+		if err1 == nil && err2 == nil && balance1 != balance2 {
+			if balance1 < balance2 {
+				return playerID1, playerID2, nil
+			}
+			return playerID2, playerID1, nil
+		}
+	default:
+		return uuid.Nil, uuid.Nil, errors.New("invalid color: " + player1Color)
+	}
+
+	if rand.IntN(2) == 0 {
+		return playerID1, playerID2, nil
+	}
+	return playerID2, playerID1, nil
+}
+
+// CreateNewGame creates a room between both players, colors are chosen by assignColors.
+// initialFEN is only used by games of the fromposition variant. With a botLevel, player 2 is the
+// built-in engine playing at that level and the game is never rated. A nil spectatorDelay uses the default of the config
+func (gm *GameManager) CreateNewGame(playerID1 uuid.UUID, playerID2 uuid.UUID, player1Color string, timeControl TimeControl, rated bool, variant string, initialFEN string, botLevel engine.Level, spectatorDelay *time.Duration) (*Game, error) {
+	// Players connected to another room are sent off, their client joins the new one
+	notice := func(gameID uuid.UUID) Message {
+		return newQuitMessage("NewGameStarted: " + gameID.String())
+	}
+	return gm.createGame(playerID1, playerID2, player1Color, timeControl, rated, variant, initialFEN, botLevel, spectatorDelay, notice)
+}
+
+// createGame creates the room of CreateNewGame. Players that are connected get the message returned by notice
+func (gm *GameManager) createGame(playerID1 uuid.UUID, playerID2 uuid.UUID, player1Color string, timeControl TimeControl, rated bool, variant string, initialFEN string, botLevel engine.Level, spectatorDelay *time.Duration, notice func(gameID uuid.UUID) Message) (*Game, error) {
+	if timeControl.Base <= 0 {
+		timeControl = gm.config.DefaultTimeControl
+	}
+
+	if botLevel != 0 {
+		if !botLevel.Valid() {
+			return nil, fmt.Errorf("invalid bot level: %d", botLevel)
+		}
+		playerID2 = BotUserID
+		rated = false
+	}
+
+	variant, initialFEN, err := startPosition(variant, initialFEN)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := newChessGame(variant, initialFEN); err != nil {
+		return nil, err
+	}
+
+	playerID1, playerID2, err = gm.assignColors(playerID1, playerID2, player1Color)
+	if err != nil {
+		return nil, err
+	}
 
 	gm.mutex.RLock()
 	p1 := gm.getPlayerNoLock(playerID1)
@@ -102,7 +199,9 @@ func (gm *GameManager) CreateNewGame(playerID1 uuid.UUID, playerID2 uuid.UUID) (
 
 	gameId := uuid.New()
 	if p1 != nil {
-		p1.SendMessageNoLock(newQuitMessage("NewGameStarted: " + gameId.String()))
+		p1.SendMessageNoLock(notice(gameId))
+	} else if playerID1 == BotUserID {
+		p1 = newBotPlayer(gm, botLevel)
 	} else {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -118,7 +217,9 @@ func (gm *GameManager) CreateNewGame(playerID1 uuid.UUID, playerID2 uuid.UUID) (
 	}
 
 	if p2 != nil {
-		p2.SendMessageNoLock(newQuitMessage("NewGameStarted: " + gameId.String()))
+		p2.SendMessageNoLock(notice(gameId))
+	} else if playerID2 == BotUserID {
+		p2 = newBotPlayer(gm, botLevel)
 	} else {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -133,19 +234,179 @@ func (gm *GameManager) CreateNewGame(playerID1 uuid.UUID, playerID2 uuid.UUID) (
 		defer p2.mutex.Unlock()
 	}
 
-	game := NewGame(gameId, p1, p2)
+	game, err := NewGame(gm, gameId, p1, p2, timeControl, rated, variant, initialFEN)
+	if err != nil {
+		return nil, err
+	}
 	game.mutex.Lock()
 	defer game.mutex.Unlock()
+	game.loadRatingsNoLock()
+	if spectatorDelay == nil {
+		spectatorDelay = &gm.config.SpectatorDelay
+	}
+	game.setSpectatorDelayNoLock(*spectatorDelay)
+	game.scheduleAbortNoLock(gm.config.ArrivalTimeout, "no-show")
 
 	p1.OngoingGame = game
 	p2.OngoingGame = game
 
 	gm.mutex.Lock()
 	gm.games[game.ID] = game
-	gm.players[p1.ID] = p1
-	gm.players[p2.ID] = p2
+	for _, p := range []*Player{p1, p2} {
+		if p.IsBot() {
+			// The bot joins the room right away, once the room is unlocked
+			go game.AddPlayer(p)
+		} else {
+			gm.players[p.ID] = p
+		}
+	}
 	gm.mutex.Unlock()
 
-	gm.gameRepo.CreateNewGame(context.TODO(), game.ID, p1.ID, p2.ID, "", "in_progress", "in_progress", "", game.StartedAt, time.Now(), "")
+	gm.gameRepo.CreateNewGame(context.TODO(), &models.Game{
+		ID:           game.ID,
+		WhiteID:      p1.ID,
+		BlackID:      p2.ID,
+		PGN:          "",
+		Status:       "in_progress",
+		Result:       "in_progress",
+		LastFEN:      "",
+		StartedAt:    game.StartedAt,
+		EndedAt:      time.Now(),
+		ResultReason: "",
+		Rated:        rated,
+		ClockBaseMs:  timeControl.Base.Milliseconds(),
+		IncrementMs:  timeControl.Increment.Milliseconds(),
+		DelayMs:      timeControl.Delay.Milliseconds(),
+		WhiteTimeMs:  timeControl.Base.Milliseconds(),
+		BlackTimeMs:  timeControl.Base.Milliseconds(),
+		TimeCategory: ratings.TimeCategory(timeControl.Base.Milliseconds(), timeControl.Increment.Milliseconds(), timeControl.Delay.Milliseconds()),
+		Variant:      variant,
+		InitialFEN:   initialFEN,
+		BotLevel:     int(botLevel),
+	})
 	return game, nil
 }
+
+// loadGamesInProgress brings back the games that were being played when the server stopped.
+// They wait for both players to send init again, with the clocks as they were after the last move
+func (gm *GameManager) loadGamesInProgress() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	storedGames, err := gm.gameRepo.GetGamesInProgress(ctx)
+	if err != nil {
+		fmt.Printf("Failed to load games in progress: %v\n", err)
+		return
+	}
+
+	gm.mutex.Lock()
+	defer gm.mutex.Unlock()
+
+	for _, stored := range storedGames {
+		chessGame, err := gm.replayGame(ctx, &stored)
+		if err != nil {
+			fmt.Printf("Failed to load game %s: %v\n", stored.ID, err)
+			gm.abortStoredGame(ctx, &stored)
+			continue
+		}
+
+		whitePlayer := gm.getPlayerNoLock(stored.WhiteID)
+		if stored.WhiteID == BotUserID {
+			whitePlayer = newBotPlayer(gm, engine.Level(stored.BotLevel))
+		} else if whitePlayer == nil {
+			whitePlayer = NewPlayer(gm, stored.WhiteID, stored.WhiteUsername)
+			gm.players[whitePlayer.ID] = whitePlayer
+		}
+		blackPlayer := gm.getPlayerNoLock(stored.BlackID)
+		if stored.BlackID == BotUserID {
+			blackPlayer = newBotPlayer(gm, engine.Level(stored.BotLevel))
+		} else if blackPlayer == nil {
+			blackPlayer = NewPlayer(gm, stored.BlackID, stored.BlackUsername)
+			gm.players[blackPlayer.ID] = blackPlayer
+		}
+
+		game, err := NewGame(gm, stored.ID, whitePlayer, blackPlayer, TimeControl{
+			Base:      time.Duration(stored.ClockBaseMs) * time.Millisecond,
+			Increment: time.Duration(stored.IncrementMs) * time.Millisecond,
+			Delay:     time.Duration(stored.DelayMs) * time.Millisecond,
+		}, stored.Rated, chessGame.variant, chessGame.initialFEN)
+		if err != nil {
+			fmt.Printf("Failed to load game %s: %v\n", stored.ID, err)
+			gm.abortStoredGame(ctx, &stored)
+			continue
+		}
+		game.StartedAt = stored.StartedAt
+		game.game = chessGame
+		game.clock.Restore(time.Duration(stored.WhiteTimeMs)*time.Millisecond, time.Duration(stored.BlackTimeMs)*time.Millisecond)
+
+		game.mutex.Lock()
+		game.restoreLastMoveNoLock()
+		game.loadRatingsNoLock()
+		game.setSpectatorDelayNoLock(gm.config.SpectatorDelay)
+		game.scheduleAbortNoLock(gm.config.ArrivalTimeout, "no-show")
+		game.mutex.Unlock()
+
+		whitePlayer.OngoingGame = game
+		blackPlayer.OngoingGame = game
+		gm.games[game.ID] = game
+		for _, p := range []*Player{whitePlayer, blackPlayer} {
+			if p.IsBot() {
+				go game.AddPlayer(p)
+			}
+		}
+		fmt.Printf("Resumed game %s (%d moves)\n", game.ID, chessGame.Plies())
+	}
+}
+
+// abortStoredGame ends a game in progress that couldn't be resumed, so that it's not left in progress
+// forever and the API lets the players look for another game
+func (gm *GameManager) abortStoredGame(ctx context.Context, stored *models.Game) {
+	stored.Status = "ended"
+	stored.Result = "aborted"
+	stored.ResultReason = "server restart"
+	stored.EndedAt = time.Now()
+
+	err := gm.gameRepo.UpdateGame(ctx, stored)
+	if err != nil {
+		fmt.Printf("Failed to abort game %s: %v\n", stored.ID, err)
+	}
+
+	// Nothing reads the stream until the API connects, so this can't hold up the start of the server
+	go func() {
+		gm.StreamChannel <- &matchmaking_grpc.GameEndedEventMsg{
+			Pl1:    stored.WhiteID.String(),
+			Pl2:    stored.BlackID.String(),
+			RoomId: stored.ID.String(),
+			Result: stored.Result,
+			Event:  "game_ended",
+		}
+	}()
+}
+
+// replayGame rebuilds the board of a stored game by playing its move history from the initial position
+func (gm *GameManager) replayGame(ctx context.Context, stored *models.Game) (*chessGame, error) {
+	initialFEN := stored.InitialFEN
+	if initialFEN == "" {
+		initialFEN = standardFEN
+	}
+
+	chessGame, err := newChessGame(stored.Variant, initialFEN)
+	if err != nil {
+		return nil, err
+	}
+
+	moves, err := gm.gameRepo.GetGameMoves(ctx, stored.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, move := range moves {
+		pending, err := chessGame.DecodeUCI(move.UCI)
+		if err != nil {
+			return nil, err
+		}
+		if err := chessGame.Play(pending); err != nil {
+			return nil, err
+		}
+	}
+	return chessGame, nil
+}
@@ -0,0 +1,51 @@
+package game
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// How long a single write of a game has to reach the database
+const gameWriteTimeout = 10 * time.Second
+
+// gameWriter stores what happens in a game without holding up the game. Writes are queued with the game's
+// lock held and run one after the other by a goroutine, so they reach the database in the order they were made
+type gameWriter struct {
+	mutex   sync.Mutex
+	pending []func(ctx context.Context)
+	running bool
+}
+
+// queueWrite schedules a write of the game after the ones already queued
+func (g *Game) queueWrite(write func(ctx context.Context)) {
+	w := g.writer
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.pending = append(w.pending, write)
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+}
+
+// run goes through the queue until it's empty, a new goroutine is started for the next write
+func (w *gameWriter) run() {
+	for {
+		w.mutex.Lock()
+		if len(w.pending) == 0 {
+			w.running = false
+			w.mutex.Unlock()
+			return
+		}
+		write := w.pending[0]
+		w.pending[0] = nil
+		w.pending = w.pending[1:]
+		w.mutex.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), gameWriteTimeout)
+		write(ctx)
+		cancel()
+	}
+}
@@ -1,5 +1,7 @@
 package game
 
+import "utils/openings"
+
 type Message struct {
 	Type string `json:"type"`
 	Data string `json:"data"`
@@ -9,27 +11,108 @@ type InitMessage struct {
 	RoomID string `json:"room_id"`
 }
 
+// SpectateMessage is the handshake of spectator connections, sent instead of init
+type SpectateMessage struct {
+	RoomID string `json:"room_id"`
+}
+
 type WelcomeContextMessage struct {
-	RoomID          string `json:"room_id"`
-	Player1ID       string `json:"player1_id"`
-	Player1Username string `json:"player1_username"`
-	Player2ID       string `json:"player2_id"`
-	Player2Username string `json:"player2_username"`
-	GameFEN         string `json:"game_fen"`
-	GamePGN         string `json:"game_pgn"`
-	LastMoveS1      string `json:"last_move_s1"`
-	LastMoveS2      string `json:"last_move_s2"`
-	GameStatus      string `json:"game_status"`
-	Winner          string `json:"winner_id"`
+	RoomID          string            `json:"room_id"`
+	Player1ID       string            `json:"player1_id"`
+	Player1Username string            `json:"player1_username"`
+	Player2ID       string            `json:"player2_id"`
+	Player2Username string            `json:"player2_username"`
+	GameFEN         string            `json:"game_fen"`
+	GamePGN         string            `json:"game_pgn"`
+	LastMoveS1      string            `json:"last_move_s1"`
+	LastMoveS2      string            `json:"last_move_s2"`
+	GameStatus      string            `json:"game_status"`
+	Winner          string            `json:"winner_id"`
+	Clock           ClockState        `json:"clock"`
+	Rated           bool              `json:"rated"`
+	Variant         string            `json:"variant"`
+	InitialFEN      string            `json:"initial_fen"`
+	Opening         *openings.Opening `json:"opening,omitempty"`
+	Spectators      int               `json:"spectators"`
+	Unlisted        bool              `json:"unlisted"`
 }
 
 type GameStartedMessage struct{}
 type GameEndedMessage struct {
 	Winner string `json:"winner_id"`
+	Reason string `json:"reason"`
+}
+
+type DrawOfferMessage struct {
+	OfferedBy string `json:"offered_by"`
+}
+
+type RematchOfferMessage struct {
+	OfferedBy string `json:"offered_by"`
+}
+
+type RematchStartedMessage struct {
+	RoomID  string `json:"room_id"`
+	WhiteID string `json:"white_id"`
+}
+
+type TakebackRequestMessage struct {
+	RequestedBy string `json:"requested_by"`
+}
+
+type TakebackMessage struct {
+	GameFEN    string            `json:"game_fen"`
+	GamePGN    string            `json:"game_pgn"`
+	LastMoveS1 string            `json:"last_move_s1"`
+	LastMoveS2 string            `json:"last_move_s2"`
+	Clock      ClockState        `json:"clock"`
+	Opening    *openings.Opening `json:"opening,omitempty"`
+}
+
+type SpectatorsMessage struct {
+	Count int `json:"count"`
+}
+
+type UnlistedMessage struct {
+	Unlisted bool `json:"unlisted"`
+}
+
+// ChatMessage is what a client sends to chat, in the channel of the players or of the spectators depending on who it is
+type ChatMessage struct {
+	Text string `json:"text"`
+}
+
+type ChatPostedMessage struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Channel  string `json:"channel"`
+	Text     string `json:"text"`
+}
+
+type ChatRejectedMessage struct {
+	Reason string `json:"reason"`
+}
+
+type MutedMessage struct {
+	Muted bool `json:"muted"`
+}
+
+type DisconnectionMessage struct {
+	PlayerID  string `json:"player_id"`
+	TimeoutMs int64  `json:"timeout_ms"`
 }
 
 type PlayerMovedMessage struct {
-	MoveS1       string `json:"move_s1"`
-	MoveS2       string `json:"move_s2"`
-	MoveNotation string `json:"move_notation"`
+	MoveS1       string      `json:"move_s1"`
+	MoveS2       string      `json:"move_s2"`
+	MoveNotation string      `json:"move_notation"`
+	Clock        *ClockState `json:"clock,omitempty"`
+}
+
+type ClockState struct {
+	WhiteTimeMs int64  `json:"white_time_ms"`
+	BlackTimeMs int64  `json:"black_time_ms"`
+	Running     string `json:"running"`
+	IncrementMs int64  `json:"increment_ms"`
+	DelayMs     int64  `json:"delay_ms"`
 }
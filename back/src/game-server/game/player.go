@@ -3,6 +3,7 @@ package game
 import (
 	"encoding/json"
 	"fmt"
+	"game-server/engine"
 	"sync"
 	"time"
 
@@ -22,9 +23,15 @@ type Player struct {
 	wsChannel           *(chan Message)
 	mutex               sync.RWMutex
 	gm                  *GameManager
+	botLevel            engine.Level // Zero for human players
+	spectator           bool         // Connection that only watches OngoingGame, see GameManager.NewSpectator
 }
 
 func (p *Player) HandleMessage(message Message) bool {
+	if p.spectator {
+		return p.handleSpectatorMessage(message)
+	}
+
 	switch message.Type {
 	case "init":
 		if p.initMessageReceived {
@@ -68,14 +75,7 @@ func (p *Player) HandleMessage(message Message) bool {
 		game.AddPlayer(p)
 		return true
 	case "player_moved":
-		var game *Game
-		p.mutex.RLock()
-		if !p.initMessageReceived {
-			p.mutex.RUnlock()
-			return false
-		}
-		game = p.OngoingGame
-		p.mutex.RUnlock()
+		game := p.currentGame()
 		if game == nil {
 			return false
 		}
@@ -87,24 +87,158 @@ func (p *Player) HandleMessage(message Message) bool {
 
 		return game.SendMove(p, moveMsg)
 	case "resign":
-		var game *Game
-		p.mutex.RLock()
-		if !p.initMessageReceived {
-			p.mutex.RUnlock()
+		game := p.currentGame()
+		if game == nil {
 			return false
 		}
-		game = p.OngoingGame
-		p.mutex.RUnlock()
+		return game.Resign(p)
+	case "abort":
+		game := p.currentGame()
 		if game == nil {
 			return false
 		}
-		return game.Resign(p)
+		return game.Abort(p)
+	case "claim_win":
+		game := p.currentGame()
+		if game == nil {
+			return false
+		}
+		return game.ClaimAbandonment(p)
+	case "offer_draw", "accept_draw", "decline_draw", "claim_draw":
+		game := p.currentGame()
+		if game == nil {
+			return false
+		}
+
+		switch message.Type {
+		case "offer_draw":
+			return game.OfferDraw(p)
+		case "accept_draw":
+			return game.AcceptDraw(p)
+		case "decline_draw":
+			return game.DeclineDraw(p)
+		default:
+			return game.ClaimDraw(p)
+		}
+	case "takeback_request", "takeback_accept", "takeback_decline":
+		game := p.currentGame()
+		if game == nil {
+			return false
+		}
+
+		switch message.Type {
+		case "takeback_request":
+			return game.RequestTakeback(p)
+		case "takeback_accept":
+			return game.AcceptTakeback(p)
+		default:
+			return game.DeclineTakeback(p)
+		}
+	case "unlist", "relist":
+		game := p.currentGame()
+		if game == nil {
+			return false
+		}
+		return game.SetUnlisted(p, message.Type == "unlist")
+	case "rematch_offer", "rematch_accept", "rematch_decline":
+		game := p.currentGame()
+		if game == nil {
+			return false
+		}
+
+		switch message.Type {
+		case "rematch_offer":
+			return game.OfferRematch(p)
+		case "rematch_accept":
+			return game.AcceptRematch(p)
+		default:
+			return game.DeclineRematch(p)
+		}
+	case "chat":
+		game := p.currentGame()
+		if game == nil {
+			return false
+		}
+		var chatMsg ChatMessage
+		err := json.Unmarshal([]byte(message.Data), &chatMsg)
+		if err != nil {
+			return false
+		}
+		return game.Chat(p, chatMsg.Text)
+	case "mute", "unmute":
+		game := p.currentGame()
+		if game == nil {
+			return false
+		}
+		return game.SetMuted(p, message.Type == "mute")
 	case "ping":
 		return true
 	}
 	return true
 }
 
+// handleSpectatorMessage handles the messages of a spectator connection. Its handshake is spectate
+// instead of init, and besides chatting it's read-only: the messages that act on the game are ignored
+func (p *Player) handleSpectatorMessage(message Message) bool {
+	switch message.Type {
+	case "spectate":
+		p.mutex.RLock()
+		initMessageReceived := p.initMessageReceived
+		p.mutex.RUnlock()
+		if initMessageReceived {
+			return false
+		}
+
+		var spectateMsg SpectateMessage
+		err := json.Unmarshal([]byte(message.Data), &spectateMsg)
+		if err != nil {
+			return false
+		}
+		gameId, err := uuid.Parse(spectateMsg.RoomID)
+		if err != nil {
+			return false
+		}
+		game := p.gm.getGame(gameId)
+		if game == nil {
+			return false
+		}
+
+		p.mutex.Lock()
+		p.initMessageReceived = true
+		p.OngoingGame = game
+		p.mutex.Unlock()
+		if !game.AddSpectator(p) {
+			p.mutex.Lock()
+			p.OngoingGame = nil
+			p.mutex.Unlock()
+			return false
+		}
+		return true
+	case "chat":
+		game := p.currentGame()
+		if game == nil {
+			return false
+		}
+		var chatMsg ChatMessage
+		err := json.Unmarshal([]byte(message.Data), &chatMsg)
+		if err != nil {
+			return false
+		}
+		return game.Chat(p, chatMsg.Text)
+	}
+	return true
+}
+
+// currentGame returns the game the connection plays or watches, nil until its handshake was received
+func (p *Player) currentGame() *Game {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if !p.initMessageReceived {
+		return nil
+	}
+	return p.OngoingGame
+}
+
 func NewPlayer(gm *GameManager, id uuid.UUID, username string) *Player {
 	trashChannel := make(chan Message, 100)
 	return &Player{
@@ -135,14 +269,39 @@ func (p *Player) KillConnection() bool {
 
 func (p *Player) OnWsClosed(conn *websocket.Conn) {
 	p.mutex.Lock()
-	defer p.mutex.Unlock()
-	if conn == p.Connection {
-		if p.wsChannel != nil {
-			*p.wsChannel <- newQuitMessage("WS closed")
-		}
-		p.Connected = false
-		p.Connection = nil
+	if conn != p.Connection {
+		p.mutex.Unlock()
+		return
 	}
+
+	if p.wsChannel != nil {
+		*p.wsChannel <- newQuitMessage("WS closed")
+	}
+	p.Connected = false
+	p.Connection = nil
+	game := p.OngoingGame
+	p.mutex.Unlock()
+
+	p.notifyDisconnected(game)
+}
+
+// notifyDisconnected lets the game know the player lost its connection.
+// It must be called without holding the player's lock
+func (p *Player) notifyDisconnected(game *Game) {
+	if game == nil {
+		return
+	}
+	if p.spectator {
+		go game.RemoveSpectator(p)
+	} else {
+		go game.PlayerDisconnected(p)
+	}
+}
+
+func (p *Player) IsConnected() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.Connected
 }
 
 func (p *Player) SendMessageNoLock(message Message) bool {
@@ -198,12 +357,15 @@ func (p *Player) UpdateConnection(conn *websocket.Conn) {
 			if message.Type == "quit" {
 				currentConnectionAlive = false
 				p.mutex.Lock()
+				var game *Game
 				if p.Connection == conn {
 					p.Connection = nil
 					p.Connected = false
+					game = p.OngoingGame
 				}
 				conn.Close()
 				p.mutex.Unlock()
+				p.notifyDisconnected(game)
 				return
 			}
 
@@ -211,12 +373,15 @@ func (p *Player) UpdateConnection(conn *websocket.Conn) {
 			if err != nil {
 				currentConnectionAlive = false
 				p.mutex.Lock()
+				var game *Game
 				if p.Connection == conn {
 					p.Connection = nil
 					p.Connected = false
+					game = p.OngoingGame
 				}
 				conn.Close()
 				p.mutex.Unlock()
+				p.notifyDisconnected(game)
 				return
 			}
 
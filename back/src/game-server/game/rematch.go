@@ -0,0 +1,193 @@
+package game
+
+import (
+	"context"
+	"encoding/json"
+	"proto-generated/matchmaking_grpc"
+	"time"
+
+	"github.com/corentings/chess/v2"
+	"github.com/google/uuid"
+)
+
+// rematchOffer is the rematch one of the players offered after the game ended
+type rematchOffer struct {
+	offeredBy chess.Color
+	timer     *time.Timer
+	// The offer was accepted and the room of the rematch is being created
+	starting bool
+}
+
+// OfferRematch offers the opponent to play again, with colors swapped. Offers can be made until the room closes,
+// and keep it open until they're answered or the rematch window is over. Offering back accepts the offer
+func (g *Game) OfferRematch(player *Player) bool {
+	g.mutex.Lock()
+	color, _ := g.playerNoLock(player)
+	if color == chess.NoColor {
+		g.mutex.Unlock()
+		return false
+	}
+	if g.Status != GameEnded || g.closed {
+		g.mutex.Unlock()
+		return true
+	}
+	if g.rematch != nil {
+		accept := g.rematch.offeredBy == color.Other() && !g.rematch.starting
+		g.mutex.Unlock()
+		if accept {
+			return g.AcceptRematch(player)
+		}
+		return true
+	}
+	defer g.mutex.Unlock()
+
+	offer := &rematchOffer{offeredBy: color}
+	offer.timer = time.AfterFunc(g.gm.config.RematchWindow, func() {
+		g.mutex.Lock()
+		if g.rematch != offer || offer.starting {
+			g.mutex.Unlock()
+			return
+		}
+		g.endRematchOfferNoLock("rematch_expired")
+		closeDue := g.closeDue
+		g.mutex.Unlock()
+
+		if closeDue {
+			g.closeRoom()
+		}
+	})
+	g.rematch = offer
+
+	jsonData, err := json.Marshal(RematchOfferMessage{
+		OfferedBy: player.ID.String(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	offerMessage := Message{
+		Type: "rematch_offered",
+		Data: string(jsonData),
+	}
+	g.WhitePlayer.SendMessage(offerMessage)
+	g.BlackPlayer.SendMessage(offerMessage)
+	return true
+}
+
+// AcceptRematch creates the room of the rematch offered by the opponent, with colors swapped and the same
+// settings, and closes this one. Both players get a rematch_started message with the new room
+func (g *Game) AcceptRematch(player *Player) bool {
+	g.mutex.Lock()
+	color, _ := g.playerNoLock(player)
+	if color == chess.NoColor {
+		g.mutex.Unlock()
+		return false
+	}
+	offer := g.rematch
+	if g.closed || offer == nil || offer.starting || offer.offeredBy != color.Other() {
+		g.mutex.Unlock()
+		return true
+	}
+
+	offer.timer.Stop()
+	offer.starting = true
+
+	// The player that had black plays white now. Against the computer, the human has to be the first player
+	playerID1, playerID2, player1Color := g.BlackPlayer.ID, g.WhitePlayer.ID, "white"
+	whiteID, blackID := g.BlackPlayer.ID, g.WhitePlayer.ID
+	botLevel := max(g.WhitePlayer.botLevel, g.BlackPlayer.botLevel)
+	if g.BlackPlayer.IsBot() {
+		playerID1, playerID2, player1Color = g.WhitePlayer.ID, uuid.Nil, "black"
+		whiteID = BotUserID
+	}
+	timeControl := g.clock.control
+	rated := g.Rated
+	variant := g.game.variant
+	initialFEN := g.game.initialFEN
+	spectatorDelay := g.spectatorDelay
+	g.mutex.Unlock()
+
+	notice := func(gameID uuid.UUID) Message {
+		jsonData, err := json.Marshal(RematchStartedMessage{
+			RoomID:  gameID.String(),
+			WhiteID: whiteID.String(),
+		})
+		if err != nil {
+			panic(err)
+		}
+		return Message{
+			Type: "rematch_started",
+			Data: string(jsonData),
+		}
+	}
+	// The lock of this room is released first, createGame needs it to see that the game is over
+	rematch, err := g.gm.createGame(playerID1, playerID2, player1Color, timeControl, rated, variant, initialFEN, botLevel, &spectatorDelay, notice)
+
+	g.mutex.Lock()
+	if err != nil {
+		g.endRematchOfferNoLock("rematch_failed")
+		closeDue := g.closeDue
+		g.mutex.Unlock()
+
+		if closeDue {
+			g.closeRoom()
+		}
+		return true
+	}
+
+	// Spectators can follow the players to the new room
+	g.rematch = nil
+	g.broadcastToSpectatorsNoLock(notice(rematch.ID))
+
+	// The API didn't ask for this room, it has to learn that the players are back in a game.
+	// Queued behind the end of this game, so the API hears about them in order
+	startedEvent := &matchmaking_grpc.GameEndedEventMsg{
+		Pl1:    whiteID.String(),
+		Pl2:    blackID.String(),
+		RoomId: rematch.ID.String(),
+		Event:  "game_started",
+	}
+	g.queueWrite(func(ctx context.Context) {
+		g.gm.StreamChannel <- startedEvent
+	})
+	g.mutex.Unlock()
+
+	g.closeRoom()
+	return true
+}
+
+// DeclineRematch turns down the rematch offered by the opponent
+func (g *Game) DeclineRematch(player *Player) bool {
+	g.mutex.Lock()
+	color, _ := g.playerNoLock(player)
+	if color == chess.NoColor {
+		g.mutex.Unlock()
+		return false
+	}
+	offer := g.rematch
+	if offer == nil || offer.starting || offer.offeredBy != color.Other() {
+		g.mutex.Unlock()
+		return true
+	}
+
+	offer.timer.Stop()
+	g.endRematchOfferNoLock("rematch_declined")
+	closeDue := g.closeDue
+	g.mutex.Unlock()
+
+	if closeDue {
+		g.closeRoom()
+	}
+	return true
+}
+
+// endRematchOfferNoLock withdraws the pending offer and tells both players why
+func (g *Game) endRematchOfferNoLock(messageType string) {
+	g.rematch = nil
+
+	message := Message{
+		Type: messageType,
+		Data: "",
+	}
+	g.WhitePlayer.SendMessage(message)
+	g.BlackPlayer.SendMessage(message)
+}
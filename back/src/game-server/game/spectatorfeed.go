@@ -0,0 +1,116 @@
+package game
+
+import (
+	"sync"
+	"time"
+)
+
+// spectatorFeed holds the messages for the spectators of a game with a broadcast delay until their time comes,
+// so that nobody in the room can relay the moves to a player while they still matter. It has its own lock:
+// messages are queued with the game's lock held, and delivered by a goroutine that takes it
+type spectatorFeed struct {
+	mutex   sync.Mutex
+	pending []delayedMessage
+	wake    chan struct{}
+	running bool
+	closed  bool
+
+	// What spectators are shown when they join: the game as it was when the last delivered message was sent.
+	// Unlike the rest of the feed, it's guarded by the game's lock
+	view *WelcomeContextMessage
+}
+
+type delayedMessage struct {
+	message Message
+	view    WelcomeContextMessage
+	at      time.Time
+}
+
+// setSpectatorDelayNoLock sets the broadcast delay of the game, spectators see it as it is now until then
+func (g *Game) setSpectatorDelayNoLock(delay time.Duration) {
+	g.spectatorDelay = delay
+	if delay > 0 {
+		view := g.welcomeContextNoLock()
+		g.feed.view = &view
+	}
+}
+
+// spectatorWelcomeNoLock describes the game to a spectator that joins it, at the position spectators are shown
+func (g *Game) spectatorWelcomeNoLock() WelcomeContextMessage {
+	if g.spectatorDelay <= 0 || g.feed.view == nil {
+		return g.welcomeContextNoLock()
+	}
+
+	welcome := *g.feed.view
+	welcome.Spectators = len(g.Spectators)
+	welcome.Unlisted = g.isUnlistedNoLock()
+	return welcome
+}
+
+// queueForSpectatorsNoLock schedules a message to be sent to the spectators once the delay is over,
+// along with the game as it is now. It's false once the feed is closed
+func (g *Game) queueForSpectatorsNoLock(message Message) bool {
+	f := g.feed
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return false
+	}
+
+	f.pending = append(f.pending, delayedMessage{
+		message: message,
+		view:    g.welcomeContextNoLock(),
+		at:      time.Now().Add(g.spectatorDelay),
+	})
+	if !f.running {
+		f.running = true
+		f.wake = make(chan struct{}, 1)
+		go g.runSpectatorFeed()
+	}
+
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// closeSpectatorFeed stops the feed once the messages already queued are delivered
+func (g *Game) closeSpectatorFeed() {
+	f := g.feed
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.closed = true
+
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runSpectatorFeed delivers the queued messages in order, each when its delay is over
+func (g *Game) runSpectatorFeed() {
+	f := g.feed
+	for {
+		f.mutex.Lock()
+		if len(f.pending) == 0 {
+			closed := f.closed
+			f.mutex.Unlock()
+			if closed {
+				return
+			}
+			<-f.wake
+			continue
+		}
+		next := f.pending[0]
+		f.pending = f.pending[1:]
+		f.mutex.Unlock()
+
+		time.Sleep(time.Until(next.at))
+
+		g.mutex.Lock()
+		f.view = &next.view
+		g.sendToSpectatorsNoLock(next.message)
+		g.mutex.Unlock()
+	}
+}
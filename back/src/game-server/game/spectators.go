@@ -0,0 +1,224 @@
+package game
+
+import (
+	"context"
+	"database/ratings"
+	"encoding/json"
+	"fmt"
+	"game-server/engine"
+	"sort"
+	"time"
+
+	"github.com/corentings/chess/v2"
+	"github.com/google/uuid"
+)
+
+// LiveGame describes an ongoing game in the list of games that can be watched
+type LiveGame struct {
+	ID            uuid.UUID
+	WhiteID       uuid.UUID
+	WhiteUsername string
+	WhiteRating   *float64
+	BlackID       uuid.UUID
+	BlackUsername string
+	BlackRating   *float64
+	Rated         bool
+	Variant       string
+	TimeControl   TimeControl
+	BotLevel      engine.Level
+	Moves         int
+	Spectators    int
+	StartedAt     time.Time
+}
+
+// NewSpectator creates the player behind a spectator connection. It's not kept in GameManager.players,
+// so watching a game never replaces the connection the user plays its own games with
+func (gm *GameManager) NewSpectator(id uuid.UUID, username string) *Player {
+	p := NewPlayer(gm, id, username)
+	p.spectator = true
+	return p
+}
+
+// LiveGames returns the ongoing games that none of the players marked as unlisted,
+// the most watched first
+func (gm *GameManager) LiveGames() []LiveGame {
+	gm.mutex.RLock()
+	games := make([]*Game, 0, len(gm.games))
+	for _, game := range gm.games {
+		games = append(games, game)
+	}
+	gm.mutex.RUnlock()
+
+	live := make([]LiveGame, 0, len(games))
+	for _, game := range games {
+		game.mutex.RLock()
+		if game.Status == GameOngoing && !game.isUnlistedNoLock() {
+			live = append(live, game.liveGameNoLock())
+		}
+		game.mutex.RUnlock()
+	}
+
+	sort.Slice(live, func(i, j int) bool {
+		if live[i].Spectators != live[j].Spectators {
+			return live[i].Spectators > live[j].Spectators
+		}
+		return live[i].StartedAt.After(live[j].StartedAt)
+	})
+	return live
+}
+
+func (g *Game) liveGameNoLock() LiveGame {
+	botLevel := g.WhitePlayer.botLevel
+	if g.BlackPlayer.IsBot() {
+		botLevel = g.BlackPlayer.botLevel
+	}
+
+	return LiveGame{
+		ID:            g.ID,
+		WhiteID:       g.WhitePlayer.ID,
+		WhiteUsername: g.WhitePlayer.Username,
+		WhiteRating:   g.whiteRating,
+		BlackID:       g.BlackPlayer.ID,
+		BlackUsername: g.BlackPlayer.Username,
+		BlackRating:   g.blackRating,
+		Rated:         g.Rated,
+		Variant:       g.game.variant,
+		TimeControl:   g.clock.control,
+		BotLevel:      botLevel,
+		Moves:         g.game.Plies(),
+		Spectators:    len(g.Spectators),
+		StartedAt:     g.StartedAt,
+	}
+}
+
+// loadRatingsNoLock looks up the ratings the players have in the time category of the game, to show them
+// in the list of live games. Bots and players that never played a rated game in the category have none
+func (g *Game) loadRatingsNoLock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	control := g.clock.control
+	category := ratings.TimeCategory(control.Base.Milliseconds(), control.Increment.Milliseconds(), control.Delay.Milliseconds())
+
+	for _, player := range []*Player{g.WhitePlayer, g.BlackPlayer} {
+		if player.IsBot() {
+			continue
+		}
+
+		rating, err := g.gm.userRepo.GetUserRating(ctx, player.ID, category)
+		if err != nil {
+			fmt.Printf("Failed to get the %s rating of %s: %v\n", category, player.ID, err)
+			continue
+		}
+		if rating == nil {
+			continue
+		}
+
+		if player == g.WhitePlayer {
+			g.whiteRating = &rating.Rating
+		} else {
+			g.blackRating = &rating.Rating
+		}
+	}
+}
+
+// AddSpectator lets a spectator connection watch the game. It's false once the game is over,
+// and for the players of the game
+func (g *Game) AddSpectator(player *Player) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status == GameEnded {
+		return false
+	}
+
+	return g.addSpectatorNoLock(player)
+}
+
+// addSpectatorNoLock is false for the players of the game, they'd see their own game with a delay
+// and could chat on the spectator channel
+func (g *Game) addSpectatorNoLock(player *Player) bool {
+	if player.ID == g.WhitePlayer.ID || player.ID == g.BlackPlayer.ID {
+		return false
+	}
+
+	// The same user watching from another connection takes the place of the previous one
+	if previous, ok := g.Spectators[player.ID]; ok && previous != player {
+		previous.SendMessage(newQuitMessage("Spectating from another connection"))
+	}
+	g.Spectators[player.ID] = player
+
+	if !player.SendMessage(newWelcomeMessage(g.spectatorWelcomeNoLock())) {
+		delete(g.Spectators, player.ID)
+		return true
+	}
+	g.broadcastSpectatorCountNoLock()
+	return true
+}
+
+// RemoveSpectator is called when the connection of a spectator closes
+func (g *Game) RemoveSpectator(player *Player) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Spectators[player.ID] != player {
+		return
+	}
+
+	delete(g.Spectators, player.ID)
+	if g.Status != GameEnded {
+		g.broadcastSpectatorCountNoLock()
+	}
+}
+
+// broadcastSpectatorCountNoLock tells everyone in the room how many spectators are watching
+func (g *Game) broadcastSpectatorCountNoLock() {
+	jsonData, err := json.Marshal(SpectatorsMessage{
+		Count: len(g.Spectators),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	message := Message{
+		Type: "spectators",
+		Data: string(jsonData),
+	}
+	g.WhitePlayer.SendMessage(message)
+	g.BlackPlayer.SendMessage(message)
+	g.broadcastToSpectatorsNoLock(message)
+}
+
+// isUnlistedNoLock reports whether any of the players asked for the game to be left out of the live games
+func (g *Game) isUnlistedNoLock() bool {
+	return g.unlisted[chess.White] || g.unlisted[chess.Black]
+}
+
+// SetUnlisted hides the game from the list of live games, or shows it again, on behalf of one of the players.
+// The game stays unlisted while any of them wants it to be. Spectators that know the room can still join
+func (g *Game) SetUnlisted(player *Player, unlisted bool) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.Status == GameEnded {
+		return true
+	}
+
+	color, _ := g.playerNoLock(player)
+	if color == chess.NoColor {
+		return false
+	}
+	g.unlisted[color] = unlisted
+
+	jsonData, err := json.Marshal(UnlistedMessage{
+		Unlisted: g.isUnlistedNoLock(),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	message := Message{
+		Type: "unlisted",
+		Data: string(jsonData),
+	}
+	g.WhitePlayer.SendMessage(message)
+	g.BlackPlayer.SendMessage(message)
+	return true
+}
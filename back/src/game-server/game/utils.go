@@ -22,3 +22,32 @@ func newQuitMessage(reason string) Message {
 		Data: reason,
 	}
 }
+
+// colorName returns the color as it is stored in the database ("white", "black" or "")
+func colorName(color chess.Color) string {
+	switch color {
+	case chess.White:
+		return "white"
+	case chess.Black:
+		return "black"
+	}
+	return ""
+}
+
+// hasMatingMaterial reports whether the given side could still deliver mate.
+// A lone king or a king with a single minor piece is treated as insufficient.
+func hasMatingMaterial(board *chess.Board, color chess.Color) bool {
+	minorPieces := 0
+	for _, piece := range board.SquareMap() {
+		if piece.Color() != color {
+			continue
+		}
+		switch piece.Type() {
+		case chess.Pawn, chess.Rook, chess.Queen:
+			return true
+		case chess.Knight, chess.Bishop:
+			minorPieces++
+		}
+	}
+	return minorPieces > 1
+}
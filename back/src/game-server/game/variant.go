@@ -0,0 +1,246 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	"github.com/corentings/chess/v2"
+)
+
+const (
+	VariantStandard = "standard"
+	// Chess960 (Fischer Random): the back rank pieces are shuffled, the start position is chosen by the server
+	VariantChess960 = "chess960"
+	// Thematic games, played from an arbitrary position given by the players
+	VariantFromPosition = "fromposition"
+)
+
+const standardFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// pgnVariantNames are the values of the [Variant] PGN tag
+var pgnVariantNames = map[string]string{
+	VariantChess960:     "Chess960",
+	VariantFromPosition: "From Position",
+}
+
+// chess960Knights lists where the knights (N) go among the five squares left after placing the bishops
+// and the queen, the king always stands between the two rooks
+var chess960Knights = [10]string{
+	"NNRKR", "NRNKR", "NRKNR", "NRKRN", "RNNKR",
+	"RNKNR", "RNKRN", "RKNNR", "RKNRN", "RKRNN",
+}
+
+// chess960StartFEN returns the Chess960 start position with the given number (0 to 959, the standard
+// position is 518), following Scharnagl's numbering. Castling rights are written in Shredder-FEN,
+// with the file of each castling rook
+func chess960StartFEN(id int) string {
+	var rank [8]byte
+
+	rank[(id%4)*2+1] = 'B'
+	id /= 4
+	rank[(id%4)*2] = 'B'
+	id /= 4
+
+	emptyFiles := func() []int {
+		files := make([]int, 0, 8)
+		for file, piece := range rank {
+			if piece == 0 {
+				files = append(files, file)
+			}
+		}
+		return files
+	}
+
+	rank[emptyFiles()[id%6]] = 'Q'
+	id /= 6
+
+	for i, file := range emptyFiles() {
+		rank[file] = chess960Knights[id][i]
+	}
+
+	castling := ""
+	for file := 7; file >= 0; file-- {
+		if rank[file] == 'R' {
+			castling += string(rune('A' + file))
+		}
+	}
+
+	white := string(rank[:])
+	black := strings.ToLower(white)
+	return fmt.Sprintf("%s/pppppppp/8/8/8/8/PPPPPPPP/%s w %s%s - 0 1", black, white, castling, strings.ToLower(castling))
+}
+
+// startPosition returns the variant and initial FEN of a new game. Chess960 games get a random
+// start position, thematic games need the FEN they start from
+func startPosition(variant string, fen string) (string, string, error) {
+	switch variant {
+	case "", VariantStandard:
+		return VariantStandard, standardFEN, nil
+	case VariantChess960:
+		return VariantChess960, chess960StartFEN(rand.IntN(960)), nil
+	case VariantFromPosition:
+		if fen == "" {
+			return "", "", errors.New("games from a position need an initial FEN")
+		}
+		return VariantFromPosition, fen, nil
+	}
+	return "", "", errors.New("unsupported variant: " + variant)
+}
+
+// parseChess960FEN reads the castling rights of a Chess960 FEN, either in Shredder-FEN (rook files)
+// or with KQkq meaning the outermost rook of each side. It returns the squares of the rooks that may
+// still castle and the same FEN without castling rights, which is what the chess library gets
+func parseChess960FEN(fen string) (map[chess.Square]bool, string, error) {
+	fields := strings.Fields(fen)
+	if len(fields) != 6 {
+		return nil, "", errors.New("invalid FEN")
+	}
+
+	libraryFields := append([]string{}, fields...)
+	libraryFields[2] = "-"
+	libraryFEN := strings.Join(libraryFields, " ")
+
+	fenOption, err := chess.FEN(libraryFEN)
+	if err != nil {
+		return nil, "", err
+	}
+	board := chess.NewGame(fenOption).Position().Board()
+
+	castling := make(map[chess.Square]bool)
+	for _, c := range fields[2] {
+		var color chess.Color
+		var rank chess.Rank
+		switch {
+		case c == '-':
+			continue
+		case c >= 'A' && c <= 'Z':
+			color, rank = chess.White, chess.Rank1
+		default:
+			color, rank = chess.Black, chess.Rank8
+		}
+
+		var rook chess.Square
+		switch c {
+		case 'K', 'k', 'Q', 'q':
+			// The outermost rook on that side of the king
+			kingFile := kingSquare(board, color).File()
+			from, to, step := chess.FileH, kingFile, chess.File(-1)
+			if c == 'Q' || c == 'q' {
+				from, to, step = chess.FileA, kingFile, 1
+			}
+			rook = chess.NoSquare
+			for file := from; file != to; file += step {
+				if board.Piece(chess.NewSquare(file, rank)) == chess.NewPiece(chess.Rook, color) {
+					rook = chess.NewSquare(file, rank)
+					break
+				}
+			}
+			if rook == chess.NoSquare {
+				return nil, "", fmt.Errorf("invalid castling rights: %c", c)
+			}
+		default:
+			lower := c | 0x20
+			if lower < 'a' || lower > 'h' {
+				return nil, "", fmt.Errorf("invalid castling rights: %c", c)
+			}
+			rook = chess.NewSquare(chess.File(lower-'a'), rank)
+		}
+
+		if board.Piece(rook) != chess.NewPiece(chess.Rook, color) || kingSquare(board, color).Rank() != rank {
+			return nil, "", fmt.Errorf("invalid castling rights: %c", c)
+		}
+		castling[rook] = true
+	}
+
+	return castling, libraryFEN, nil
+}
+
+// shredderCastling writes castling rights as the files of the rooks that may castle, white's first,
+// from the h-file to the a-file as in the start positions
+func shredderCastling(rooks map[chess.Square]bool) string {
+	castling := ""
+	for _, color := range []chess.Color{chess.White, chess.Black} {
+		for file := chess.FileH; file >= chess.FileA; file-- {
+			if !rooks[chess.NewSquare(file, backRank(color))] {
+				continue
+			}
+			if color == chess.White {
+				castling += string(rune('A' + int(file)))
+			} else {
+				castling += string(rune('a' + int(file)))
+			}
+		}
+	}
+	if castling == "" {
+		return "-"
+	}
+	return castling
+}
+
+func kingSquare(board *chess.Board, color chess.Color) chess.Square {
+	for sq, piece := range board.SquareMap() {
+		if piece == chess.NewPiece(chess.King, color) {
+			return sq
+		}
+	}
+	return chess.NoSquare
+}
+
+// isAttacked reports whether any piece of the given color attacks the square
+func isAttacked(pieces map[chess.Square]chess.Piece, sq chess.Square, by chess.Color) bool {
+	file, rank := int(sq.File()), int(sq.Rank())
+
+	pieceAt := func(f int, r int) chess.Piece {
+		if f < 0 || f > 7 || r < 0 || r > 7 {
+			return chess.NoPiece
+		}
+		return pieces[chess.NewSquare(chess.File(f), chess.Rank(r))]
+	}
+
+	pawnRank := rank - 1
+	if by == chess.Black {
+		pawnRank = rank + 1
+	}
+	if pieceAt(file-1, pawnRank) == chess.NewPiece(chess.Pawn, by) || pieceAt(file+1, pawnRank) == chess.NewPiece(chess.Pawn, by) {
+		return true
+	}
+
+	for _, d := range [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}} {
+		if pieceAt(file+d[0], rank+d[1]) == chess.NewPiece(chess.Knight, by) {
+			return true
+		}
+	}
+
+	for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, 1}, {1, -1}, {-1, 1}, {-1, -1}} {
+		diagonal := d[0] != 0 && d[1] != 0
+		for f, r, dist := file+d[0], rank+d[1], 1; f >= 0 && f <= 7 && r >= 0 && r <= 7; f, r, dist = f+d[0], r+d[1], dist+1 {
+			piece := pieceAt(f, r)
+			if piece == chess.NoPiece {
+				continue
+			}
+			if piece.Color() == by {
+				switch piece.Type() {
+				case chess.Queen:
+					return true
+				case chess.King:
+					if dist == 1 {
+						return true
+					}
+				case chess.Bishop:
+					if diagonal {
+						return true
+					}
+				case chess.Rook:
+					if !diagonal {
+						return true
+					}
+				}
+			}
+			break
+		}
+	}
+
+	return false
+}
@@ -4,13 +4,16 @@ import (
 	"context"
 	"database/repositories"
 	"fmt"
+	"game-server/engine"
 	"game-server/game"
 	"net"
 	"net/http"
+	"os"
 	"proto-generated/auth_grpc"
 	"proto-generated/matchmaking_grpc"
 	"time"
 	"utils"
+	"utils/uci"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -45,15 +48,26 @@ func (s *MatchMakingServer) RequestRoom(ctx context.Context, req *matchmaking_gr
 			ErrorMsg: proto.String("PlayerId_1 must be an UUID"),
 		}, nil
 	}
+	// Games against the computer have no second player
 	id2, err := uuid.Parse(req.PlayerId_2)
-	if err != nil {
+	if err != nil && req.BotLevel == 0 {
 		return &matchmaking_grpc.RoomResponse{
 			RoomId:   "",
 			ErrorMsg: proto.String("PlayerId_2 must be an UUID"),
 		}, nil
 	}
 
-	game, err := gm.CreateNewGame(id1, id2)
+	timeControl := game.TimeControl{
+		Base:      time.Duration(req.ClockBaseMs) * time.Millisecond,
+		Increment: time.Duration(req.ClockIncrementMs) * time.Millisecond,
+		Delay:     time.Duration(req.ClockDelayMs) * time.Millisecond,
+	}
+	var spectatorDelay *time.Duration
+	if req.SpectatorDelayMs != nil {
+		delay := time.Duration(*req.SpectatorDelayMs) * time.Millisecond
+		spectatorDelay = &delay
+	}
+	game, err := gm.CreateNewGame(id1, id2, req.Player_1Color, timeControl, req.Rated, req.Variant, req.InitialFen, engine.Level(req.BotLevel), spectatorDelay)
 	if err != nil {
 		error_msg := err.Error()
 		return &matchmaking_grpc.RoomResponse{
@@ -63,12 +77,13 @@ func (s *MatchMakingServer) RequestRoom(ctx context.Context, req *matchmaking_gr
 	}
 
 	return &matchmaking_grpc.RoomResponse{
-		RoomId: game.ID.String(),
+		RoomId:  game.ID.String(),
+		WhiteId: game.WhitePlayer.ID.String(),
 	}, nil
 }
 
 func (s *MatchMakingServer) StartStreamMsg(reqMsg *matchmaking_grpc.StartStreamingMessage, stream matchmaking_grpc.MatchMaking_StartStreamMsgServer) error {
-	fmt.Println("API Server connected to stream. Ready to send game_ended events")
+	fmt.Println("API Server connected to stream. Ready to send game_ended and game_started events")
 	for {
 		select {
 		case <-stream.Context().Done():
@@ -82,24 +97,57 @@ func (s *MatchMakingServer) StartStreamMsg(reqMsg *matchmaking_grpc.StartStreami
 			}
 
 			// Send the msg
-			if err := stream.Send(&message); err != nil {
+			if err := stream.Send(message); err != nil {
 				fmt.Printf("Got error while sending stream msg: %v\n", err)
 				return err
 			}
 
-			fmt.Printf("Game Ended Notification sent: %v\n", message)
+			fmt.Printf("Stream notification sent: %v\n", message)
 		}
 	}
 
 }
 
-func handlePlayerConnection(w http.ResponseWriter, r *http.Request) {
+func (s *MatchMakingServer) ListLiveGames(ctx context.Context, req *matchmaking_grpc.ListLiveGamesMessage) (*matchmaking_grpc.LiveGamesResponse, error) {
+	liveGames := gm.LiveGames()
+
+	response := &matchmaking_grpc.LiveGamesResponse{
+		Games: make([]*matchmaking_grpc.LiveGame, 0, len(liveGames)),
+	}
+	for _, g := range liveGames {
+		response.Games = append(response.Games, &matchmaking_grpc.LiveGame{
+			RoomId: g.ID.String(),
+			White: &matchmaking_grpc.LiveGamePlayer{
+				Id:       g.WhiteID.String(),
+				Username: g.WhiteUsername,
+				Rating:   g.WhiteRating,
+			},
+			Black: &matchmaking_grpc.LiveGamePlayer{
+				Id:       g.BlackID.String(),
+				Username: g.BlackUsername,
+				Rating:   g.BlackRating,
+			},
+			Rated:            g.Rated,
+			Variant:          g.Variant,
+			ClockBaseMs:      g.TimeControl.Base.Milliseconds(),
+			ClockIncrementMs: g.TimeControl.Increment.Milliseconds(),
+			Moves:            int32(g.Moves),
+			Spectators:       int32(g.Spectators),
+			StartedAtMs:      g.StartedAt.UnixMilli(),
+			BotLevel:         int32(g.BotLevel),
+		})
+	}
+	return response, nil
+}
+
+// authenticate validates the session of a WebSocket request. When it fails, the response was already written
+func authenticate(w http.ResponseWriter, r *http.Request) (*auth_grpc.Session, bool) {
 	sessionToken, err := r.Cookie("session_token")
 	csrfToken := r.URL.Query().Get("csrfToken")
 
 	if err != nil || csrfToken == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		return nil, false
 	}
 
 	if !utils.ValidateCSRFToken(csrfToken, sessionToken.Value) {
@@ -112,7 +160,7 @@ func handlePlayerConnection(w http.ResponseWriter, r *http.Request) {
 			SameSite: http.SameSiteLaxMode,
 		})
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		return nil, false
 	}
 
 	res, err := authGrpc.ValidateSession(context.Background(), &auth_grpc.SessionValidationInput{
@@ -121,7 +169,7 @@ func handlePlayerConnection(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil || !res.Res.Ok {
 		http.Error(w, "Internal Error", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
 
 	if res.Session == nil || res.Session.UserId == "" {
@@ -134,10 +182,34 @@ func handlePlayerConnection(w http.ResponseWriter, r *http.Request) {
 			SameSite: http.SameSiteLaxMode,
 		})
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return res.Session, true
+}
+
+func handlePlayerConnection(w http.ResponseWriter, r *http.Request) {
+	session, ok := authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	p := gm.GetOrMakePlayer(uuid.MustParse(session.UserId), session.Username)
+	connect(w, r, p)
+}
+
+// handleSpectatorConnection opens a read-only connection, that joins a game with spectate instead of init
+func handleSpectatorConnection(w http.ResponseWriter, r *http.Request) {
+	session, ok := authenticate(w, r)
+	if !ok {
 		return
 	}
 
-	p := gm.GetOrMakePlayer(uuid.MustParse(res.Session.UserId), res.Session.Username)
+	p := gm.NewSpectator(uuid.MustParse(session.UserId), session.Username)
+	connect(w, r, p)
+}
+
+func connect(w http.ResponseWriter, r *http.Request, p *game.Player) {
 	ws, err := upgrader.Upgrade(w, r, nil)
 
 	if err != nil {
@@ -166,7 +238,32 @@ func main() {
 	dbPool := utils.RetryPostgresConnection(postgresUrl, time.Second)
 	userRepo := repositories.NewUserRepo(dbPool)
 	gameRepo := repositories.NewGameRepo(dbPool)
-	gm = game.NewGameManager(userRepo, gameRepo)
+
+	// Bots play with the built-in engine unless a UCI engine is installed
+	var botEngine uci.Engine
+	if enginePath := os.Getenv("UCI_ENGINE_PATH"); enginePath != "" {
+		enginePool := uci.NewPool(uci.Config{
+			Path:    enginePath,
+			Options: map[string]string{"Threads": "1", "Hash": "32"},
+			Size:    4,
+		})
+		defer enginePool.Close()
+		botEngine = enginePool
+	}
+
+	gm = game.NewGameManager(userRepo, gameRepo, &game.Config{
+		DefaultTimeControl: game.TimeControl{
+			Base:      10 * time.Minute,
+			Increment: 0,
+			Delay:     0,
+		},
+		ArrivalTimeout:   time.Minute,
+		FirstMoveTimeout: 30 * time.Second,
+		ReconnectTimeout: time.Minute,
+		BotEngine:        botEngine,
+		SpectatorDelay:   10 * time.Second,
+		RematchWindow:    15 * time.Second,
+	})
 
 	go func() {
 		grpcListener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", grpcPort))
@@ -185,6 +282,7 @@ func main() {
 	}()
 
 	http.HandleFunc("/ws", handlePlayerConnection)
+	http.HandleFunc("/ws/spectate", handleSpectatorConnection)
 
 	fmt.Printf("WS game server listening at 0.0.0.0%s\n", port)
 	err := http.ListenAndServe(fmt.Sprintf("0.0.0.0:%s", port), nil)
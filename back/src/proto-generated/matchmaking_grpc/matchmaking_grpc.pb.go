@@ -22,9 +22,23 @@ const (
 )
 
 type RequestRoomMessage struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	PlayerId_1    string                 `protobuf:"bytes,1,opt,name=player_id_1,json=playerId1,proto3" json:"player_id_1,omitempty"`
-	PlayerId_2    string                 `protobuf:"bytes,2,opt,name=player_id_2,json=playerId2,proto3" json:"player_id_2,omitempty"`
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	PlayerId_1       string                 `protobuf:"bytes,1,opt,name=player_id_1,json=playerId1,proto3" json:"player_id_1,omitempty"`
+	PlayerId_2       string                 `protobuf:"bytes,2,opt,name=player_id_2,json=playerId2,proto3" json:"player_id_2,omitempty"`
+	Rated            bool                   `protobuf:"varint,3,opt,name=rated,proto3" json:"rated,omitempty"`
+	ClockBaseMs      int64                  `protobuf:"varint,4,opt,name=clock_base_ms,json=clockBaseMs,proto3" json:"clock_base_ms,omitempty"`
+	ClockIncrementMs int64                  `protobuf:"varint,5,opt,name=clock_increment_ms,json=clockIncrementMs,proto3" json:"clock_increment_ms,omitempty"`
+	Variant          string                 `protobuf:"bytes,6,opt,name=variant,proto3" json:"variant,omitempty"`
+	// Color of player_id_1: "white", "black", "random" or "balanced" (default, by each player's recent games)
+	Player_1Color string `protobuf:"bytes,7,opt,name=player_1_color,json=player1Color,proto3" json:"player_1_color,omitempty"`
+	// Position the game starts from, only for the "fromposition" variant
+	InitialFen string `protobuf:"bytes,8,opt,name=initial_fen,json=initialFen,proto3" json:"initial_fen,omitempty"`
+	// Level of the built-in engine (1 to 8) for games against the computer, player_id_2 is ignored then
+	BotLevel int32 `protobuf:"varint,9,opt,name=bot_level,json=botLevel,proto3" json:"bot_level,omitempty"`
+	// Delay of what spectators are shown, the game server's default if absent. Zero shows the game live
+	SpectatorDelayMs *int64 `protobuf:"varint,10,opt,name=spectator_delay_ms,json=spectatorDelayMs,proto3,oneof" json:"spectator_delay_ms,omitempty"`
+	// Bronstein delay of every move, on top of the increment
+	ClockDelayMs  int64 `protobuf:"varint,11,opt,name=clock_delay_ms,json=clockDelayMs,proto3" json:"clock_delay_ms,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -73,10 +87,74 @@ func (x *RequestRoomMessage) GetPlayerId_2() string {
 	return ""
 }
 
+func (x *RequestRoomMessage) GetRated() bool {
+	if x != nil {
+		return x.Rated
+	}
+	return false
+}
+
+func (x *RequestRoomMessage) GetClockBaseMs() int64 {
+	if x != nil {
+		return x.ClockBaseMs
+	}
+	return 0
+}
+
+func (x *RequestRoomMessage) GetClockIncrementMs() int64 {
+	if x != nil {
+		return x.ClockIncrementMs
+	}
+	return 0
+}
+
+func (x *RequestRoomMessage) GetVariant() string {
+	if x != nil {
+		return x.Variant
+	}
+	return ""
+}
+
+func (x *RequestRoomMessage) GetPlayer_1Color() string {
+	if x != nil {
+		return x.Player_1Color
+	}
+	return ""
+}
+
+func (x *RequestRoomMessage) GetInitialFen() string {
+	if x != nil {
+		return x.InitialFen
+	}
+	return ""
+}
+
+func (x *RequestRoomMessage) GetBotLevel() int32 {
+	if x != nil {
+		return x.BotLevel
+	}
+	return 0
+}
+
+func (x *RequestRoomMessage) GetSpectatorDelayMs() int64 {
+	if x != nil && x.SpectatorDelayMs != nil {
+		return *x.SpectatorDelayMs
+	}
+	return 0
+}
+
+func (x *RequestRoomMessage) GetClockDelayMs() int64 {
+	if x != nil {
+		return x.ClockDelayMs
+	}
+	return 0
+}
+
 type RoomResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	RoomId        string                 `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
 	ErrorMsg      *string                `protobuf:"bytes,2,opt,name=error_msg,json=errorMsg,proto3,oneof" json:"error_msg,omitempty"`
+	WhiteId       string                 `protobuf:"bytes,3,opt,name=white_id,json=whiteId,proto3" json:"white_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -125,6 +203,13 @@ func (x *RoomResponse) GetErrorMsg() string {
 	return ""
 }
 
+func (x *RoomResponse) GetWhiteId() string {
+	if x != nil {
+		return x.WhiteId
+	}
+	return ""
+}
+
 type StartStreamingMessage struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -162,9 +247,13 @@ func (*StartStreamingMessage) Descriptor() ([]byte, []int) {
 }
 
 type GameEndedEventMsg struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Pl1           string                 `protobuf:"bytes,1,opt,name=pl1,proto3" json:"pl1,omitempty"`
-	Pl2           string                 `protobuf:"bytes,2,opt,name=pl2,proto3" json:"pl2,omitempty"`
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Pl1    string                 `protobuf:"bytes,1,opt,name=pl1,proto3" json:"pl1,omitempty"`
+	Pl2    string                 `protobuf:"bytes,2,opt,name=pl2,proto3" json:"pl2,omitempty"`
+	RoomId string                 `protobuf:"bytes,3,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	Result string                 `protobuf:"bytes,4,opt,name=result,proto3" json:"result,omitempty"`
+	// "game_ended", or "game_started" for rooms the game server opens on its own, like rematches
+	Event         string `protobuf:"bytes,5,opt,name=event,proto3" json:"event,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -213,26 +302,352 @@ func (x *GameEndedEventMsg) GetPl2() string {
 	return ""
 }
 
+func (x *GameEndedEventMsg) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+func (x *GameEndedEventMsg) GetResult() string {
+	if x != nil {
+		return x.Result
+	}
+	return ""
+}
+
+func (x *GameEndedEventMsg) GetEvent() string {
+	if x != nil {
+		return x.Event
+	}
+	return ""
+}
+
+type ListLiveGamesMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLiveGamesMessage) Reset() {
+	*x = ListLiveGamesMessage{}
+	mi := &file_matchmaking_grpc_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLiveGamesMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLiveGamesMessage) ProtoMessage() {}
+
+func (x *ListLiveGamesMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_matchmaking_grpc_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLiveGamesMessage.ProtoReflect.Descriptor instead.
+func (*ListLiveGamesMessage) Descriptor() ([]byte, []int) {
+	return file_matchmaking_grpc_proto_rawDescGZIP(), []int{4}
+}
+
+type LiveGamePlayer struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Id       string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Username string                 `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+	// Rating in the time category of the game, absent for bots and players without one
+	Rating        *float64 `protobuf:"fixed64,3,opt,name=rating,proto3,oneof" json:"rating,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LiveGamePlayer) Reset() {
+	*x = LiveGamePlayer{}
+	mi := &file_matchmaking_grpc_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LiveGamePlayer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LiveGamePlayer) ProtoMessage() {}
+
+func (x *LiveGamePlayer) ProtoReflect() protoreflect.Message {
+	mi := &file_matchmaking_grpc_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LiveGamePlayer.ProtoReflect.Descriptor instead.
+func (*LiveGamePlayer) Descriptor() ([]byte, []int) {
+	return file_matchmaking_grpc_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *LiveGamePlayer) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *LiveGamePlayer) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *LiveGamePlayer) GetRating() float64 {
+	if x != nil && x.Rating != nil {
+		return *x.Rating
+	}
+	return 0
+}
+
+type LiveGame struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	RoomId           string                 `protobuf:"bytes,1,opt,name=room_id,json=roomId,proto3" json:"room_id,omitempty"`
+	White            *LiveGamePlayer        `protobuf:"bytes,2,opt,name=white,proto3" json:"white,omitempty"`
+	Black            *LiveGamePlayer        `protobuf:"bytes,3,opt,name=black,proto3" json:"black,omitempty"`
+	Rated            bool                   `protobuf:"varint,4,opt,name=rated,proto3" json:"rated,omitempty"`
+	Variant          string                 `protobuf:"bytes,5,opt,name=variant,proto3" json:"variant,omitempty"`
+	ClockBaseMs      int64                  `protobuf:"varint,6,opt,name=clock_base_ms,json=clockBaseMs,proto3" json:"clock_base_ms,omitempty"`
+	ClockIncrementMs int64                  `protobuf:"varint,7,opt,name=clock_increment_ms,json=clockIncrementMs,proto3" json:"clock_increment_ms,omitempty"`
+	Moves            int32                  `protobuf:"varint,8,opt,name=moves,proto3" json:"moves,omitempty"`
+	Spectators       int32                  `protobuf:"varint,9,opt,name=spectators,proto3" json:"spectators,omitempty"`
+	StartedAtMs      int64                  `protobuf:"varint,10,opt,name=started_at_ms,json=startedAtMs,proto3" json:"started_at_ms,omitempty"`
+	BotLevel         int32                  `protobuf:"varint,11,opt,name=bot_level,json=botLevel,proto3" json:"bot_level,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *LiveGame) Reset() {
+	*x = LiveGame{}
+	mi := &file_matchmaking_grpc_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LiveGame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LiveGame) ProtoMessage() {}
+
+func (x *LiveGame) ProtoReflect() protoreflect.Message {
+	mi := &file_matchmaking_grpc_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LiveGame.ProtoReflect.Descriptor instead.
+func (*LiveGame) Descriptor() ([]byte, []int) {
+	return file_matchmaking_grpc_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *LiveGame) GetRoomId() string {
+	if x != nil {
+		return x.RoomId
+	}
+	return ""
+}
+
+func (x *LiveGame) GetWhite() *LiveGamePlayer {
+	if x != nil {
+		return x.White
+	}
+	return nil
+}
+
+func (x *LiveGame) GetBlack() *LiveGamePlayer {
+	if x != nil {
+		return x.Black
+	}
+	return nil
+}
+
+func (x *LiveGame) GetRated() bool {
+	if x != nil {
+		return x.Rated
+	}
+	return false
+}
+
+func (x *LiveGame) GetVariant() string {
+	if x != nil {
+		return x.Variant
+	}
+	return ""
+}
+
+func (x *LiveGame) GetClockBaseMs() int64 {
+	if x != nil {
+		return x.ClockBaseMs
+	}
+	return 0
+}
+
+func (x *LiveGame) GetClockIncrementMs() int64 {
+	if x != nil {
+		return x.ClockIncrementMs
+	}
+	return 0
+}
+
+func (x *LiveGame) GetMoves() int32 {
+	if x != nil {
+		return x.Moves
+	}
+	return 0
+}
+
+func (x *LiveGame) GetSpectators() int32 {
+	if x != nil {
+		return x.Spectators
+	}
+	return 0
+}
+
+func (x *LiveGame) GetStartedAtMs() int64 {
+	if x != nil {
+		return x.StartedAtMs
+	}
+	return 0
+}
+
+func (x *LiveGame) GetBotLevel() int32 {
+	if x != nil {
+		return x.BotLevel
+	}
+	return 0
+}
+
+type LiveGamesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Games         []*LiveGame            `protobuf:"bytes,1,rep,name=games,proto3" json:"games,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LiveGamesResponse) Reset() {
+	*x = LiveGamesResponse{}
+	mi := &file_matchmaking_grpc_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LiveGamesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LiveGamesResponse) ProtoMessage() {}
+
+func (x *LiveGamesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_matchmaking_grpc_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LiveGamesResponse.ProtoReflect.Descriptor instead.
+func (*LiveGamesResponse) Descriptor() ([]byte, []int) {
+	return file_matchmaking_grpc_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *LiveGamesResponse) GetGames() []*LiveGame {
+	if x != nil {
+		return x.Games
+	}
+	return nil
+}
+
 var File_matchmaking_grpc_proto protoreflect.FileDescriptor
 
 const file_matchmaking_grpc_proto_rawDesc = "" +
 	"\n" +
-	"\x16matchmaking_grpc.proto\"T\n" +
+	"\x16matchmaking_grpc.proto\"\xaa\x03\n" +
 	"\x12RequestRoomMessage\x12\x1e\n" +
 	"\vplayer_id_1\x18\x01 \x01(\tR\tplayerId1\x12\x1e\n" +
-	"\vplayer_id_2\x18\x02 \x01(\tR\tplayerId2\"W\n" +
+	"\vplayer_id_2\x18\x02 \x01(\tR\tplayerId2\x12\x14\n" +
+	"\x05rated\x18\x03 \x01(\bR\x05rated\x12\"\n" +
+	"\rclock_base_ms\x18\x04 \x01(\x03R\vclockBaseMs\x12,\n" +
+	"\x12clock_increment_ms\x18\x05 \x01(\x03R\x10clockIncrementMs\x12\x18\n" +
+	"\avariant\x18\x06 \x01(\tR\avariant\x12$\n" +
+	"\x0eplayer_1_color\x18\a \x01(\tR\fplayer1Color\x12\x1f\n" +
+	"\vinitial_fen\x18\b \x01(\tR\n" +
+	"initialFen\x12\x1b\n" +
+	"\tbot_level\x18\t \x01(\x05R\bbotLevel\x121\n" +
+	"\x12spectator_delay_ms\x18\n" +
+	" \x01(\x03H\x00R\x10spectatorDelayMs\x88\x01\x01\x12$\n" +
+	"\x0eclock_delay_ms\x18\v \x01(\x03R\fclockDelayMsB\x15\n" +
+	"\x13_spectator_delay_ms\"r\n" +
 	"\fRoomResponse\x12\x17\n" +
 	"\aroom_id\x18\x01 \x01(\tR\x06roomId\x12 \n" +
-	"\terror_msg\x18\x02 \x01(\tH\x00R\berrorMsg\x88\x01\x01B\f\n" +
+	"\terror_msg\x18\x02 \x01(\tH\x00R\berrorMsg\x88\x01\x01\x12\x19\n" +
+	"\bwhite_id\x18\x03 \x01(\tR\awhiteIdB\f\n" +
 	"\n" +
 	"_error_msg\"\x17\n" +
-	"\x15StartStreamingMessage\"7\n" +
+	"\x15StartStreamingMessage\"~\n" +
 	"\x11GameEndedEventMsg\x12\x10\n" +
 	"\x03pl1\x18\x01 \x01(\tR\x03pl1\x12\x10\n" +
-	"\x03pl2\x18\x02 \x01(\tR\x03pl22\x82\x01\n" +
+	"\x03pl2\x18\x02 \x01(\tR\x03pl2\x12\x17\n" +
+	"\aroom_id\x18\x03 \x01(\tR\x06roomId\x12\x16\n" +
+	"\x06result\x18\x04 \x01(\tR\x06result\x12\x14\n" +
+	"\x05event\x18\x05 \x01(\tR\x05event\"\x16\n" +
+	"\x14ListLiveGamesMessage\"d\n" +
+	"\x0eLiveGamePlayer\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1a\n" +
+	"\busername\x18\x02 \x01(\tR\busername\x12\x1b\n" +
+	"\x06rating\x18\x03 \x01(\x01H\x00R\x06rating\x88\x01\x01B\t\n" +
+	"\a_rating\"\xea\x02\n" +
+	"\bLiveGame\x12\x17\n" +
+	"\aroom_id\x18\x01 \x01(\tR\x06roomId\x12%\n" +
+	"\x05white\x18\x02 \x01(\v2\x0f.LiveGamePlayerR\x05white\x12%\n" +
+	"\x05black\x18\x03 \x01(\v2\x0f.LiveGamePlayerR\x05black\x12\x14\n" +
+	"\x05rated\x18\x04 \x01(\bR\x05rated\x12\x18\n" +
+	"\avariant\x18\x05 \x01(\tR\avariant\x12\"\n" +
+	"\rclock_base_ms\x18\x06 \x01(\x03R\vclockBaseMs\x12,\n" +
+	"\x12clock_increment_ms\x18\a \x01(\x03R\x10clockIncrementMs\x12\x14\n" +
+	"\x05moves\x18\b \x01(\x05R\x05moves\x12\x1e\n" +
+	"\n" +
+	"spectators\x18\t \x01(\x05R\n" +
+	"spectators\x12\"\n" +
+	"\rstarted_at_ms\x18\n" +
+	" \x01(\x03R\vstartedAtMs\x12\x1b\n" +
+	"\tbot_level\x18\v \x01(\x05R\bbotLevel\"4\n" +
+	"\x11LiveGamesResponse\x12\x1f\n" +
+	"\x05games\x18\x01 \x03(\v2\t.LiveGameR\x05games2\xc0\x01\n" +
 	"\vMatchMaking\x123\n" +
 	"\vRequestRoom\x12\x13.RequestRoomMessage\x1a\r.RoomResponse\"\x00\x12>\n" +
-	"\x0eStartStreamMsg\x12\x16.StartStreamingMessage\x1a\x12.GameEndedEventMsg0\x01B\x14Z\x12./matchmaking_grpcb\x06proto3"
+	"\x0eStartStreamMsg\x12\x16.StartStreamingMessage\x1a\x12.GameEndedEventMsg0\x01\x12<\n" +
+	"\rListLiveGames\x12\x15.ListLiveGamesMessage\x1a\x12.LiveGamesResponse\"\x00B\x14Z\x12./matchmaking_grpcb\x06proto3"
 
 var (
 	file_matchmaking_grpc_proto_rawDescOnce sync.Once
@@ -246,23 +661,32 @@ func file_matchmaking_grpc_proto_rawDescGZIP() []byte {
 	return file_matchmaking_grpc_proto_rawDescData
 }
 
-var file_matchmaking_grpc_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_matchmaking_grpc_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_matchmaking_grpc_proto_goTypes = []any{
 	(*RequestRoomMessage)(nil),    // 0: RequestRoomMessage
 	(*RoomResponse)(nil),          // 1: RoomResponse
 	(*StartStreamingMessage)(nil), // 2: StartStreamingMessage
 	(*GameEndedEventMsg)(nil),     // 3: GameEndedEventMsg
+	(*ListLiveGamesMessage)(nil),  // 4: ListLiveGamesMessage
+	(*LiveGamePlayer)(nil),        // 5: LiveGamePlayer
+	(*LiveGame)(nil),              // 6: LiveGame
+	(*LiveGamesResponse)(nil),     // 7: LiveGamesResponse
 }
 var file_matchmaking_grpc_proto_depIdxs = []int32{
-	0, // 0: MatchMaking.RequestRoom:input_type -> RequestRoomMessage
-	2, // 1: MatchMaking.StartStreamMsg:input_type -> StartStreamingMessage
-	1, // 2: MatchMaking.RequestRoom:output_type -> RoomResponse
-	3, // 3: MatchMaking.StartStreamMsg:output_type -> GameEndedEventMsg
-	2, // [2:4] is the sub-list for method output_type
-	0, // [0:2] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	5, // 0: LiveGame.white:type_name -> LiveGamePlayer
+	5, // 1: LiveGame.black:type_name -> LiveGamePlayer
+	6, // 2: LiveGamesResponse.games:type_name -> LiveGame
+	0, // 3: MatchMaking.RequestRoom:input_type -> RequestRoomMessage
+	2, // 4: MatchMaking.StartStreamMsg:input_type -> StartStreamingMessage
+	4, // 5: MatchMaking.ListLiveGames:input_type -> ListLiveGamesMessage
+	1, // 6: MatchMaking.RequestRoom:output_type -> RoomResponse
+	3, // 7: MatchMaking.StartStreamMsg:output_type -> GameEndedEventMsg
+	7, // 8: MatchMaking.ListLiveGames:output_type -> LiveGamesResponse
+	6, // [6:9] is the sub-list for method output_type
+	3, // [3:6] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_matchmaking_grpc_proto_init() }
@@ -270,14 +694,16 @@ func file_matchmaking_grpc_proto_init() {
 	if File_matchmaking_grpc_proto != nil {
 		return
 	}
+	file_matchmaking_grpc_proto_msgTypes[0].OneofWrappers = []any{}
 	file_matchmaking_grpc_proto_msgTypes[1].OneofWrappers = []any{}
+	file_matchmaking_grpc_proto_msgTypes[5].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_matchmaking_grpc_proto_rawDesc), len(file_matchmaking_grpc_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
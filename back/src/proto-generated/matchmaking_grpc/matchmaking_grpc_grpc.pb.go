@@ -21,6 +21,7 @@ const _ = grpc.SupportPackageIsVersion9
 const (
 	MatchMaking_RequestRoom_FullMethodName    = "/MatchMaking/RequestRoom"
 	MatchMaking_StartStreamMsg_FullMethodName = "/MatchMaking/StartStreamMsg"
+	MatchMaking_ListLiveGames_FullMethodName  = "/MatchMaking/ListLiveGames"
 )
 
 // MatchMakingClient is the client API for MatchMaking service.
@@ -29,6 +30,8 @@ const (
 type MatchMakingClient interface {
 	RequestRoom(ctx context.Context, in *RequestRoomMessage, opts ...grpc.CallOption) (*RoomResponse, error)
 	StartStreamMsg(ctx context.Context, in *StartStreamingMessage, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GameEndedEventMsg], error)
+	// Ongoing games that none of the players marked as unlisted
+	ListLiveGames(ctx context.Context, in *ListLiveGamesMessage, opts ...grpc.CallOption) (*LiveGamesResponse, error)
 }
 
 type matchMakingClient struct {
@@ -68,12 +71,24 @@ func (c *matchMakingClient) StartStreamMsg(ctx context.Context, in *StartStreami
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type MatchMaking_StartStreamMsgClient = grpc.ServerStreamingClient[GameEndedEventMsg]
 
+func (c *matchMakingClient) ListLiveGames(ctx context.Context, in *ListLiveGamesMessage, opts ...grpc.CallOption) (*LiveGamesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LiveGamesResponse)
+	err := c.cc.Invoke(ctx, MatchMaking_ListLiveGames_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MatchMakingServer is the server API for MatchMaking service.
 // All implementations must embed UnimplementedMatchMakingServer
 // for forward compatibility.
 type MatchMakingServer interface {
 	RequestRoom(context.Context, *RequestRoomMessage) (*RoomResponse, error)
 	StartStreamMsg(*StartStreamingMessage, grpc.ServerStreamingServer[GameEndedEventMsg]) error
+	// Ongoing games that none of the players marked as unlisted
+	ListLiveGames(context.Context, *ListLiveGamesMessage) (*LiveGamesResponse, error)
 	mustEmbedUnimplementedMatchMakingServer()
 }
 
@@ -90,6 +105,9 @@ func (UnimplementedMatchMakingServer) RequestRoom(context.Context, *RequestRoomM
 func (UnimplementedMatchMakingServer) StartStreamMsg(*StartStreamingMessage, grpc.ServerStreamingServer[GameEndedEventMsg]) error {
 	return status.Errorf(codes.Unimplemented, "method StartStreamMsg not implemented")
 }
+func (UnimplementedMatchMakingServer) ListLiveGames(context.Context, *ListLiveGamesMessage) (*LiveGamesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLiveGames not implemented")
+}
 func (UnimplementedMatchMakingServer) mustEmbedUnimplementedMatchMakingServer() {}
 func (UnimplementedMatchMakingServer) testEmbeddedByValue()                     {}
 
@@ -140,6 +158,24 @@ func _MatchMaking_StartStreamMsg_Handler(srv interface{}, stream grpc.ServerStre
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type MatchMaking_StartStreamMsgServer = grpc.ServerStreamingServer[GameEndedEventMsg]
 
+func _MatchMaking_ListLiveGames_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLiveGamesMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MatchMakingServer).ListLiveGames(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MatchMaking_ListLiveGames_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MatchMakingServer).ListLiveGames(ctx, req.(*ListLiveGamesMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // MatchMaking_ServiceDesc is the grpc.ServiceDesc for MatchMaking service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -151,6 +187,10 @@ var MatchMaking_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "RequestRoom",
 			Handler:    _MatchMaking_RequestRoom_Handler,
 		},
+		{
+			MethodName: "ListLiveGames",
+			Handler:    _MatchMaking_ListLiveGames_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -0,0 +1,88 @@
+// Package openings names the opening a game follows, with its code in the Encyclopaedia of Chess Openings
+// (A00 to E99). The table is embedded from openings.tsv, taken from https://github.com/lichess-org/chess-openings
+// (public domain): one line per named position, with its ECO code, name, moves and EPD
+package openings
+
+import (
+	_ "embed"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/corentings/chess/v2"
+)
+
+//go:embed openings.tsv
+var table string
+
+type Opening struct {
+	ECO  string `json:"eco"`
+	Name string `json:"name"`
+	PGN  string `json:"-"` // Moves that lead to the position, in the order the table lists them
+}
+
+var (
+	loadOnce   sync.Once
+	byPosition map[string]*Opening
+)
+
+// load indexes the table by position, the first time an opening is looked up
+func load() {
+	lines := strings.Split(strings.TrimSpace(table), "\n")
+	byPosition = make(map[string]*Opening, len(lines))
+
+	// The first line holds the column names: eco, name, pgn, uci, epd
+	for _, line := range lines[1:] {
+		columns := strings.Split(line, "\t")
+		if len(columns) != 5 {
+			continue
+		}
+		byPosition[positionKey(columns[4])] = &Opening{
+			ECO:  columns[0],
+			Name: columns[1],
+			PGN:  columns[2],
+		}
+	}
+}
+
+// positionKey identifies a position by its pieces, side to move and castling rights. The en passant square is
+// left out: the chess library sets it after every double pawn push, the table only where a capture is possible
+func positionKey(fen string) string {
+	fields := strings.Fields(fen)
+	if len(fields) > 3 {
+		fields = fields[:3]
+	}
+	return strings.Join(fields, " ")
+}
+
+// Lookup returns the opening of a position given by its FEN (or EPD), nil if the position isn't named in the table
+func Lookup(fen string) *Opening {
+	loadOnce.Do(load)
+	return byPosition[positionKey(fen)]
+}
+
+// Classify returns the opening of a game given the FENs of its positions in the order they were played:
+// the last of them that is named in the table. Transpositions into a known line are recognised
+func Classify(fens []string) *Opening {
+	for i := len(fens) - 1; i >= 0; i-- {
+		if opening := Lookup(fens[i]); opening != nil {
+			return opening
+		}
+	}
+	return nil
+}
+
+// ClassifyMoves returns the opening of a game given its moves in UCI notation, played from the standard position
+func ClassifyMoves(moves []string) (*Opening, error) {
+	game := chess.NewGame()
+	fens := make([]string, 0, len(moves))
+
+	for _, move := range moves {
+		if err := game.PushNotationMove(move, chess.UCINotation{}, nil); err != nil {
+			return nil, errors.New("invalid move: " + move)
+		}
+		fens = append(fens, game.FEN())
+	}
+
+	return Classify(fens), nil
+}
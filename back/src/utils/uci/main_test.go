@@ -0,0 +1,215 @@
+package uci
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The test binary runs itself as a fake engine when this variable is set, so the tests need no engine installed
+const fakeEngineEnv = "UCI_FAKE_ENGINE"
+
+// Moving crashMove makes the fake engine exit in the middle of the search
+const crashMove = "crash"
+
+// Principal variations of the fake engine, best first
+var fakeLines = []string{"e2e4 e7e5", "d2d4 d7d5", "g1f3 g8f6"}
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeEngineEnv) == "1" {
+		os.Exit(runFakeEngine(os.Args[1:]))
+	}
+
+	os.Setenv(fakeEngineEnv, "1")
+	os.Exit(m.Run())
+}
+
+// runFakeEngine speaks just enough UCI for the tests. Every command it gets is appended to the file given by -log,
+// and with -silent it never answers. Each depth of a search takes 1000 nodes, and scores 10 centipawns more
+func runFakeEngine(args []string) int {
+	flags := flag.NewFlagSet("fake engine", flag.ContinueOnError)
+	logPath := flags.String("log", "", "file the received commands are appended to")
+	silent := flags.Bool("silent", false, "never answer")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var logFile *os.File
+	if *logPath != "" {
+		var err error
+		logFile, err = os.OpenFile(*logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return 2
+		}
+		defer logFile.Close()
+	}
+	received := func(command string) {
+		if logFile != nil {
+			fmt.Fprintln(logFile, command)
+		}
+	}
+
+	commands := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			commands <- scanner.Text()
+		}
+		close(commands)
+	}()
+
+	multiPV := 1
+	crash := false
+	for command := range commands {
+		received(command)
+		fields := strings.Fields(command)
+		if *silent || len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "uci":
+			fmt.Println("id name Fake Engine")
+			fmt.Println("id author uci tests")
+			fmt.Println("option name MultiPV type spin default 1 min 1 max 3")
+			fmt.Println("uciok")
+		case "isready":
+			fmt.Println("readyok")
+		case "setoption":
+			if len(fields) == 5 && fields[2] == "MultiPV" {
+				multiPV, _ = strconv.Atoi(fields[4])
+				multiPV = min(max(multiPV, 1), len(fakeLines))
+			}
+		case "position":
+			crash = fields[len(fields)-1] == crashMove
+		case "go":
+			if !fakeSearch(fields[1:], multiPV, crash, commands, received) {
+				return 0
+			}
+		case "quit":
+			return 0
+		}
+	}
+	return 0
+}
+
+// fakeSearch searches until the limits of the go command are reached, or until it's stopped.
+// It's false if the engine has to exit
+func fakeSearch(args []string, multiPV int, crash bool, commands <-chan string, received func(string)) bool {
+	depth, nodes, moveTime := 0, int64(0), time.Duration(0)
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "depth":
+			depth, _ = strconv.Atoi(args[i+1])
+		case "nodes":
+			nodes, _ = strconv.ParseInt(args[i+1], 10, 64)
+		case "movetime":
+			ms, _ := strconv.Atoi(args[i+1])
+			moveTime = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+
+search:
+	for d := 1; ; d++ {
+		if nodes > 0 && int64(d)*1000 > nodes {
+			break
+		}
+
+		fmt.Printf("info depth %d currmove e2e4 currmovenumber 1\n", d)
+		for k := 1; k <= multiPV; k++ {
+			fmt.Printf("info depth %d multipv %d score cp %d nodes %d pv %s\n", d, k, 10*d-5*(k-1), 1000*d, fakeLines[k-1])
+		}
+		fmt.Println("info string still searching")
+		if crash {
+			os.Exit(1)
+		}
+
+		if depth > 0 && d >= depth {
+			break
+		}
+		if depth > 0 || nodes > 0 {
+			continue
+		}
+
+		// Searches by time, or infinite ones, go one depth deeper on every tick
+		select {
+		case <-ticker.C:
+		case command, ok := <-commands:
+			if !ok {
+				return false
+			}
+			received(command)
+			switch command {
+			case "quit":
+				return false
+			case "stop":
+				break search
+			case "isready":
+				fmt.Println("readyok")
+			}
+		}
+		if moveTime > 0 && time.Since(start) >= moveTime {
+			break
+		}
+	}
+
+	fmt.Println("bestmove e2e4 ponder e7e5")
+	return true
+}
+
+// fakeEngine returns the path and arguments that run the fake engine, logging to a file of the test
+func fakeEngine(t *testing.T, extraArgs ...string) (string, []string, string) {
+	t.Helper()
+	path, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logPath := t.TempDir() + "/commands.log"
+	return path, append([]string{"-log", logPath}, extraArgs...), logPath
+}
+
+// receivedCommands returns the commands the fake engines logging to logPath got so far
+func receivedCommands(t *testing.T, logPath string) []string {
+	t.Helper()
+	data, err := os.ReadFile(logPath)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+// countCommand tells how many times the fake engines got the command, each process gets "uci" once
+func countCommand(t *testing.T, logPath string, command string) int {
+	t.Helper()
+	count := 0
+	for _, line := range receivedCommands(t, logPath) {
+		if line == command {
+			count++
+		}
+	}
+	return count
+}
+
+// waitForCommand waits until some fake engine got a command starting with prefix
+func waitForCommand(t *testing.T, logPath string, prefix string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, line := range receivedCommands(t, logPath) {
+			if strings.HasPrefix(line, prefix) {
+				return
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("the engine never got %q", prefix)
+}
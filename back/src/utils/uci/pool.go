@@ -0,0 +1,112 @@
+package uci
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrPoolClosed = errors.New("engine pool is closed")
+
+type Config struct {
+	Path    string            // Engine binary
+	Args    []string          // Command line arguments of the engine
+	Options map[string]string // UCI options set on every process, e.g. {"Threads": "1", "Hash": "64"}
+
+	Size         int           // Most processes running at once, searches wait for a free one
+	StartTimeout time.Duration // How long a new process has to answer "uciok" and "readyok"
+	StopTimeout  time.Duration // How long the engine has to send "bestmove" after "stop", or to exit after "quit"
+}
+
+// Pool runs up to Size engine processes, started when needed and reused between searches.
+// A process that misbehaves (exits, or doesn't answer in time) is killed and replaced by a new one
+type Pool struct {
+	config Config
+	slots  chan struct{}
+	mutex  sync.Mutex
+	idle   []*Process
+	closed bool
+}
+
+func NewPool(config Config) *Pool {
+	if config.Size <= 0 {
+		config.Size = 1
+	}
+	if config.StartTimeout <= 0 {
+		config.StartTimeout = 10 * time.Second
+	}
+	if config.StopTimeout <= 0 {
+		config.StopTimeout = 2 * time.Second
+	}
+	return &Pool{
+		config: config,
+		slots:  make(chan struct{}, config.Size),
+		idle:   make([]*Process, 0, config.Size),
+	}
+}
+
+// Analyse runs the request on a free process, waiting for one if all of them are busy
+func (pool *Pool) Analyse(ctx context.Context, req Request) (*Result, error) {
+	select {
+	case pool.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-pool.slots }()
+
+	process, err := pool.takeProcess(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := process.Analyse(ctx, req)
+	if result == nil {
+		// The process is in an unknown state, a new one is started next time
+		process.Close()
+		return nil, err
+	}
+
+	pool.putProcess(process)
+	return result, err
+}
+
+func (pool *Pool) takeProcess(ctx context.Context) (*Process, error) {
+	pool.mutex.Lock()
+	if pool.closed {
+		pool.mutex.Unlock()
+		return nil, ErrPoolClosed
+	}
+	if n := len(pool.idle); n > 0 {
+		process := pool.idle[n-1]
+		pool.idle = pool.idle[:n-1]
+		pool.mutex.Unlock()
+		return process, nil
+	}
+	pool.mutex.Unlock()
+
+	startCtx, cancel := context.WithTimeout(ctx, pool.config.StartTimeout)
+	defer cancel()
+	return Start(startCtx, pool.config.Path, pool.config.Args, pool.config.Options, pool.config.StopTimeout)
+}
+
+func (pool *Pool) putProcess(process *Process) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if pool.closed {
+		go process.Close()
+		return
+	}
+	pool.idle = append(pool.idle, process)
+}
+
+// Close stops the idle processes, the ones searching are stopped when they're done
+func (pool *Pool) Close() {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	pool.closed = true
+	for _, process := range pool.idle {
+		go process.Close()
+	}
+	pool.idle = nil
+}
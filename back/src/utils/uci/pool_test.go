@@ -0,0 +1,115 @@
+package uci
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newFakePool(t *testing.T, size int) (*Pool, string) {
+	t.Helper()
+	path, args, logPath := fakeEngine(t)
+	pool := NewPool(Config{
+		Path:        path,
+		Args:        args,
+		Size:        size,
+		StopTimeout: time.Second,
+	})
+	t.Cleanup(pool.Close)
+	return pool, logPath
+}
+
+func TestPoolReusesIdleProcess(t *testing.T) {
+	pool, logPath := newFakePool(t, 2)
+
+	for range 3 {
+		if _, err := pool.Analyse(context.Background(), Request{Depth: 1}); err != nil {
+			t.Fatalf("Analyse() error = %v", err)
+		}
+	}
+	if started := countCommand(t, logPath, "uci"); started != 1 {
+		t.Errorf("started %d processes, want 1", started)
+	}
+}
+
+func TestPoolLimitsProcesses(t *testing.T) {
+	const size, searches = 2, 6
+	const moveTime = 30 * time.Millisecond
+	pool, logPath := newFakePool(t, size)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	errs := make(chan error, searches)
+	for range searches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := pool.Analyse(context.Background(), Request{MoveTime: moveTime})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Analyse() error = %v", err)
+		}
+	}
+	if started := countCommand(t, logPath, "uci"); started != size {
+		t.Errorf("started %d processes, want %d", started, size)
+	}
+	if elapsed := time.Since(start); elapsed < searches/size*moveTime {
+		t.Errorf("%d searches took %v, more than %d ran at once", searches, elapsed, size)
+	}
+}
+
+func TestPoolWaitsForFreeSlot(t *testing.T) {
+	pool, logPath := newFakePool(t, 1)
+
+	done := make(chan error)
+	go func() {
+		_, err := pool.Analyse(context.Background(), Request{MoveTime: 300 * time.Millisecond})
+		done <- err
+	}()
+	waitForCommand(t, logPath, "go movetime")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	result, err := pool.Analyse(ctx, Request{Depth: 1})
+	if result != nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Analyse() while busy = %+v, %v, want a deadline error", result, err)
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("Analyse() error = %v", err)
+	}
+}
+
+func TestPoolReplacesCrashedProcess(t *testing.T) {
+	pool, logPath := newFakePool(t, 1)
+
+	result, err := pool.Analyse(context.Background(), Request{Moves: []string{crashMove}, Depth: 5})
+	if result != nil || !errors.Is(err, ErrEngineExited) {
+		t.Fatalf("Analyse() = %+v, %v, want %v", result, err, ErrEngineExited)
+	}
+
+	result, err = pool.Analyse(context.Background(), Request{Depth: 2})
+	if err != nil || result.BestMove != "e2e4" {
+		t.Fatalf("Analyse() after the crash = %+v, %v", result, err)
+	}
+	if started := countCommand(t, logPath, "uci"); started != 2 {
+		t.Errorf("started %d processes, want 2", started)
+	}
+}
+
+func TestPoolClosed(t *testing.T) {
+	pool, _ := newFakePool(t, 1)
+	pool.Close()
+
+	if _, err := pool.Analyse(context.Background(), Request{Depth: 1}); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Analyse() error = %v, want %v", err, ErrPoolClosed)
+	}
+}
@@ -0,0 +1,208 @@
+package uci
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrEngineExited = errors.New("engine process exited")
+
+// Process is a running engine. It handles one search at a time, Pool shares processes between callers
+type Process struct {
+	cmd         *exec.Cmd
+	stdin       io.WriteCloser
+	lines       chan string // Output of the engine, closed when the process exits
+	stopTimeout time.Duration
+	Name        string // As given by "id name"
+}
+
+// Start runs the engine and waits until it's ready to search, after setting its options
+func Start(ctx context.Context, path string, args []string, options map[string]string, stopTimeout time.Duration) (*Process, error) {
+	cmd := exec.Command(path, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &Process{
+		cmd:         cmd,
+		stdin:       stdin,
+		lines:       make(chan string, 256),
+		stopTimeout: stopTimeout,
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			p.lines <- scanner.Text()
+		}
+		close(p.lines)
+		cmd.Wait()
+	}()
+
+	if err := p.handshake(ctx, options); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Process) handshake(ctx context.Context, options map[string]string) error {
+	if err := p.send("uci"); err != nil {
+		return err
+	}
+	for {
+		line, err := p.readLine(ctx)
+		if err != nil {
+			return err
+		}
+		if name, ok := strings.CutPrefix(line, "id name "); ok {
+			p.Name = name
+		}
+		if line == "uciok" {
+			break
+		}
+	}
+
+	// Options are set in a fixed order, some engines care (Threads before Hash)
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := p.send(fmt.Sprintf("setoption name %s value %s", name, options[name])); err != nil {
+			return err
+		}
+	}
+
+	return p.waitReady(ctx)
+}
+
+// waitReady sends "isready" and waits for "readyok", discarding anything the engine sent before
+func (p *Process) waitReady(ctx context.Context) error {
+	if err := p.send("isready"); err != nil {
+		return err
+	}
+	for {
+		line, err := p.readLine(ctx)
+		if err != nil {
+			return err
+		}
+		if line == "readyok" {
+			return nil
+		}
+	}
+}
+
+// Analyse searches the position of the request. If the context is done before the engine is through,
+// the search is stopped and what the engine found so far is returned along with the context's error
+func (p *Process) Analyse(ctx context.Context, req Request) (*Result, error) {
+	multiPV := max(req.MultiPV, 1)
+
+	if err := p.send(fmt.Sprintf("setoption name MultiPV value %d", multiPV)); err != nil {
+		return nil, err
+	}
+	if err := p.waitReady(ctx); err != nil {
+		return nil, err
+	}
+	if err := p.send(positionCommand(req)); err != nil {
+		return nil, err
+	}
+	if err := p.send(goCommand(req)); err != nil {
+		return nil, err
+	}
+
+	lines := make(map[int]Line)
+	result := &Result{}
+	var searchErr error
+
+	for {
+		line, err := p.readLine(ctx)
+		if err != nil && searchErr == nil && ctx.Err() != nil {
+			// Ask for the best move found so far, the engine has a moment to answer
+			searchErr = ctx.Err()
+			if err := p.send("stop"); err != nil {
+				return nil, err
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(context.Background(), p.stopTimeout)
+			defer cancel()
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(line, "info ") {
+			if info, ok := parseInfo(line); ok && info.MultiPV <= multiPV {
+				lines[info.MultiPV] = info
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "bestmove") {
+			result.BestMove, result.Ponder = parseBestMove(line)
+			break
+		}
+	}
+
+	for i := 1; i <= multiPV; i++ {
+		if line, ok := lines[i]; ok {
+			result.Lines = append(result.Lines, line)
+		}
+	}
+	return result, searchErr
+}
+
+func (p *Process) send(command string) error {
+	_, err := io.WriteString(p.stdin, command+"\n")
+	return err
+}
+
+func (p *Process) readLine(ctx context.Context) (string, error) {
+	select {
+	case line, ok := <-p.lines:
+		if !ok {
+			return "", ErrEngineExited
+		}
+		return strings.TrimSpace(line), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Close asks the engine to quit and kills it if it's still running after a moment
+func (p *Process) Close() {
+	p.send("quit")
+	p.stdin.Close()
+
+	timer := time.NewTimer(p.stopTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case _, ok := <-p.lines:
+			if !ok {
+				return
+			}
+		case <-timer.C:
+			p.cmd.Process.Kill()
+			return
+		}
+	}
+}
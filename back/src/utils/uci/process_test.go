@@ -0,0 +1,186 @@
+package uci
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startFake(t *testing.T, extraArgs ...string) (*Process, string) {
+	t.Helper()
+	path, args, logPath := fakeEngine(t, extraArgs...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := Start(ctx, path, args, nil, time.Second)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(p.Close)
+	return p, logPath
+}
+
+// lastCommand returns the last command starting with prefix the engine got
+func lastCommand(t *testing.T, logPath string, prefix string) string {
+	t.Helper()
+	commands := receivedCommands(t, logPath)
+	for i := len(commands) - 1; i >= 0; i-- {
+		if strings.HasPrefix(commands[i], prefix) {
+			return commands[i]
+		}
+	}
+	return ""
+}
+
+func TestStartHandshake(t *testing.T) {
+	path, args, logPath := fakeEngine(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p, err := Start(ctx, path, args, map[string]string{"Threads": "1", "Hash": "64"}, time.Second)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer p.Close()
+
+	if p.Name != "Fake Engine" {
+		t.Errorf("Name = %q, want %q", p.Name, "Fake Engine")
+	}
+	want := []string{"uci", "setoption name Hash value 64", "setoption name Threads value 1", "isready"}
+	if got := receivedCommands(t, logPath); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+func TestStartUnresponsiveEngine(t *testing.T) {
+	path, args, _ := fakeEngine(t, "-silent")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	p, err := Start(ctx, path, args, nil, 100*time.Millisecond)
+	if p != nil || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Start() = %v, %v, want a deadline error", p, err)
+	}
+}
+
+func TestAnalyse(t *testing.T) {
+	const fen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+	tests := []struct {
+		name         string
+		req          Request
+		wantPosition string
+		wantGo       string
+		wantDepth    int
+		wantLines    []Line
+	}{
+		{
+			name:         "depth",
+			req:          Request{Depth: 3},
+			wantPosition: "position startpos",
+			wantGo:       "go depth 3",
+			wantLines: []Line{
+				{MultiPV: 1, Depth: 3, Nodes: 3000, Score: Score{Centipawns: 30}, PV: []string{"e2e4", "e7e5"}},
+			},
+		},
+		{
+			name:         "nodes",
+			req:          Request{Nodes: 2500},
+			wantPosition: "position startpos",
+			wantGo:       "go nodes 2500",
+			wantLines: []Line{
+				{MultiPV: 1, Depth: 2, Nodes: 2000, Score: Score{Centipawns: 20}, PV: []string{"e2e4", "e7e5"}},
+			},
+		},
+		{
+			name:         "multipv from a position",
+			req:          Request{FEN: fen, Moves: []string{"e2e4", "e7e5"}, Depth: 2, MultiPV: 2},
+			wantPosition: "position fen " + fen + " moves e2e4 e7e5",
+			wantGo:       "go depth 2",
+			wantLines: []Line{
+				{MultiPV: 1, Depth: 2, Nodes: 2000, Score: Score{Centipawns: 20}, PV: []string{"e2e4", "e7e5"}},
+				{MultiPV: 2, Depth: 2, Nodes: 2000, Score: Score{Centipawns: 15}, PV: []string{"d2d4", "d7d5"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, logPath := startFake(t)
+
+			result, err := p.Analyse(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("Analyse() error = %v", err)
+			}
+			if result.BestMove != "e2e4" || result.Ponder != "e7e5" {
+				t.Errorf("best move = %s ponder %s, want e2e4 ponder e7e5", result.BestMove, result.Ponder)
+			}
+			if !reflect.DeepEqual(result.Lines, tt.wantLines) {
+				t.Errorf("Lines = %+v, want %+v", result.Lines, tt.wantLines)
+			}
+			if got := lastCommand(t, logPath, "position"); got != tt.wantPosition {
+				t.Errorf("position command = %q, want %q", got, tt.wantPosition)
+			}
+			if got := lastCommand(t, logPath, "go"); got != tt.wantGo {
+				t.Errorf("go command = %q, want %q", got, tt.wantGo)
+			}
+		})
+	}
+}
+
+func TestAnalyseMoveTime(t *testing.T) {
+	p, logPath := startFake(t)
+
+	start := time.Now()
+	result, err := p.Analyse(context.Background(), Request{MoveTime: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Analyse() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("search took %v, want at least the move time", elapsed)
+	}
+	if result.BestMove != "e2e4" || len(result.Lines) != 1 {
+		t.Errorf("Analyse() = %+v, want a best move and a line", result)
+	}
+	if got := lastCommand(t, logPath, "go"); got != "go movetime 50" {
+		t.Errorf("go command = %q, want %q", got, "go movetime 50")
+	}
+}
+
+func TestAnalyseCancelReturnsPartialResult(t *testing.T) {
+	p, logPath := startFake(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result, err := p.Analyse(ctx, Request{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Analyse() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if result == nil || result.BestMove != "e2e4" || len(result.Lines) != 1 || result.Lines[0].Depth == 0 {
+		t.Fatalf("Analyse() = %+v, want what was found before the stop", result)
+	}
+	if got := lastCommand(t, logPath, "go"); got != "go infinite" {
+		t.Errorf("go command = %q, want %q", got, "go infinite")
+	}
+	if countCommand(t, logPath, "stop") != 1 {
+		t.Errorf("the engine was not stopped")
+	}
+
+	// The process can search again after a stop
+	result, err = p.Analyse(context.Background(), Request{Depth: 1})
+	if err != nil || result.BestMove != "e2e4" {
+		t.Errorf("Analyse() after stop = %+v, %v", result, err)
+	}
+}
+
+func TestAnalyseEngineExits(t *testing.T) {
+	p, _ := startFake(t)
+
+	result, err := p.Analyse(context.Background(), Request{Moves: []string{crashMove}, Depth: 5})
+	if result != nil || !errors.Is(err, ErrEngineExited) {
+		t.Errorf("Analyse() = %+v, %v, want %v", result, err, ErrEngineExited)
+	}
+}
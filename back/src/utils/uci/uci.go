@@ -0,0 +1,138 @@
+// Package uci talks to chess engines through the Universal Chess Interface, running them as local processes
+package uci
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Engine evaluates positions. It's implemented by Pool, and can be replaced by a stub where no engine is installed
+type Engine interface {
+	Analyse(ctx context.Context, req Request) (*Result, error)
+}
+
+// Request is a position to search and how long to search it. Unset limits are not sent,
+// an engine given none of them searches until the context is done
+type Request struct {
+	FEN      string   // Position to search, empty for the standard start position
+	Moves    []string // Moves played from FEN, in UCI notation (e2e4, e7e8q)
+	Depth    int
+	Nodes    int64
+	MoveTime time.Duration
+	MultiPV  int // How many of the best lines to return, 1 if unset
+}
+
+// Score is an evaluation from the point of view of the side to move
+type Score struct {
+	Centipawns int
+	IsMate     bool
+	Mate       int // If IsMate, moves to mate, negative if the side to move gets mated (zero: it's mated already)
+	LowerBound bool
+	UpperBound bool
+}
+
+// Line is the last info the engine sent for one of its principal variations
+type Line struct {
+	MultiPV int
+	Depth   int
+	Nodes   int64
+	Score   Score
+	PV      []string
+}
+
+type Result struct {
+	BestMove string
+	Ponder   string
+	Lines    []Line // Best line first
+}
+
+// positionCommand builds the "position" command of a request
+func positionCommand(req Request) string {
+	var sb strings.Builder
+	if req.FEN == "" {
+		sb.WriteString("position startpos")
+	} else {
+		sb.WriteString("position fen " + req.FEN)
+	}
+	if len(req.Moves) > 0 {
+		sb.WriteString(" moves " + strings.Join(req.Moves, " "))
+	}
+	return sb.String()
+}
+
+// goCommand builds the "go" command of a request
+func goCommand(req Request) string {
+	command := "go"
+	if req.Depth > 0 {
+		command += " depth " + strconv.Itoa(req.Depth)
+	}
+	if req.Nodes > 0 {
+		command += " nodes " + strconv.FormatInt(req.Nodes, 10)
+	}
+	if req.MoveTime > 0 {
+		command += " movetime " + strconv.FormatInt(req.MoveTime.Milliseconds(), 10)
+	}
+	if req.Depth <= 0 && req.Nodes <= 0 && req.MoveTime <= 0 {
+		command += " infinite"
+	}
+	return command
+}
+
+// parseInfo reads an "info" line. ok is false for infos without a score, like currmove updates
+func parseInfo(line string) (info Line, ok bool) {
+	fields := strings.Fields(line)
+	info.MultiPV = 1
+
+	for i := 1; i < len(fields); i++ {
+		next := func() string {
+			if i+1 < len(fields) {
+				i++
+				return fields[i]
+			}
+			return ""
+		}
+
+		switch fields[i] {
+		case "depth":
+			info.Depth, _ = strconv.Atoi(next())
+		case "nodes":
+			info.Nodes, _ = strconv.ParseInt(next(), 10, 64)
+		case "multipv":
+			info.MultiPV, _ = strconv.Atoi(next())
+		case "score":
+			ok = true
+		case "cp":
+			info.Score.Centipawns, _ = strconv.Atoi(next())
+		case "mate":
+			info.Score.IsMate = true
+			info.Score.Mate, _ = strconv.Atoi(next())
+		case "lowerbound":
+			info.Score.LowerBound = true
+		case "upperbound":
+			info.Score.UpperBound = true
+		case "pv":
+			info.PV = append([]string{}, fields[i+1:]...)
+			i = len(fields)
+		case "string":
+			// Free text until the end of the line
+			return Line{}, false
+		}
+	}
+
+	return info, ok
+}
+
+// parseBestMove reads a "bestmove" line
+func parseBestMove(line string) (string, string) {
+	fields := strings.Fields(line)
+	best, ponder := "", ""
+	if len(fields) > 1 {
+		best = fields[1]
+	}
+	if len(fields) > 3 && fields[2] == "ponder" {
+		ponder = fields[3]
+	}
+	return best, ponder
+}